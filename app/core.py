@@ -1,7 +1,7 @@
 import streamlit as st
 import requests
+import json
 import os
-from typing import Set
 
 GO_SERVER_URL = os.getenv("GO_LLM_URL", "http://localhost:8080")
 
@@ -21,32 +21,101 @@ if (
 tab1, tab2 = st.tabs(["Query", "Ingest New Docs"])
 
 
-def create_sources_string(source_urls: Set[str]) -> str:
-    if not source_urls:
+def create_sources_string(response: dict) -> str:
+    """Lists the cited sources by citation number, or every source when nothing was cited."""
+    citations = response.get("citations") or [
+        {"number": source["number"], "source": source} for source in response.get("sources", [])
+    ]
+    if not citations:
         return ""
-    sources_list = list(source_urls)
-    sources_list.sort()
     sources_string = "sources:\n"
-    for i, source in enumerate(sources_list):
-        sources_string += f"{i+1}. {source}\n"
+    for citation in citations:
+        sources_string += f"[{citation['number']}] {citation['source']['url']}\n"
     return sources_string
 
 
+QUERY_RESPONSE_VERSION = 2
+
+
+def check_version(response: dict):
+    if response.get("version") != QUERY_RESPONSE_VERSION:
+        raise ValueError(f"unsupported response version {response.get('version')}, expected {QUERY_RESPONSE_VERSION}")
+
+
 # Tab 1: Query Documentation
 with tab1:
     st.subheader("Ask Questions")
     prompt = st.text_input("Prompt", placeholder="Enter your prompt here...", key="query_input")
+    stream_answers = st.checkbox("Stream answers", value=True, key="stream_answers")
 
     def call_go_llm(query: str, chat_history: list) -> dict:
         try:
             payload = {"query": query, "num_docs": 5, "chat_history": chat_history}
             resp = requests.post(f"{GO_SERVER_URL}/run", json=payload, timeout=60)
+            if resp.status_code == 504 and resp.json().get("code") == "timeout":
+                return {"error": "the query timed out, try a shorter question or fewer documents"}
             resp.raise_for_status()
-            return resp.json()
+            response = resp.json()
+            check_version(response)
+            return response
         except Exception as e:
             return {"error": str(e)}
 
-    if prompt:
+    def stream_go_llm(query: str, chat_history: list, final: dict):
+        """Yields answer tokens from /run/stream and fills `final` with the sources, answer and error."""
+        payload = {"query": query, "num_docs": 5, "chat_history": chat_history}
+        with requests.post(f"{GO_SERVER_URL}/run/stream", json=payload, stream=True, timeout=60) as resp:
+            resp.raise_for_status()
+            event = None
+            for line in resp.iter_lines(decode_unicode=True):
+                if line.startswith("event: "):
+                    event = line[len("event: "):]
+                elif line.startswith("data: "):
+                    data = json.loads(line[len("data: "):])
+                    if event == "token":
+                        yield data["text"]
+                    elif event == "sources":
+                        final["sources"] = data["sources"]
+                    elif event == "done":
+                        check_version(data)
+                        final["answer"] = data["answer"]
+                        final["citations"] = data["citations"]
+                    elif event == "error":
+                        if data.get("code") == "timeout":
+                            final["error"] = "the query timed out, try a shorter question or fewer documents"
+                        else:
+                            final["error"] = data["error"]
+
+    if prompt and stream_answers:
+        for answer, user_query in zip(
+            st.session_state["chat_answers_history"],
+            st.session_state["user_prompt_history"],
+        ):
+            st.chat_message("user").write(user_query)
+            st.chat_message("assistant").write(answer)
+
+        st.chat_message("user").write(prompt)
+        final_response = {}
+        try:
+            with st.chat_message("assistant"):
+                st.write_stream(stream_go_llm(prompt, st.session_state["chat_history"], final_response))
+        except Exception as e:
+            final_response["error"] = str(e)
+
+        if final_response.get("error"):
+            st.error("Error from Go server: " + final_response["error"])
+        else:
+            sources = create_sources_string(final_response)
+            st.write(sources)
+
+            st.session_state["user_prompt_history"].append(prompt)
+            st.session_state["chat_answers_history"].append(
+                final_response["answer"] + "\n\n" + sources
+            )
+            st.session_state["chat_history"].append(("human", prompt)) # (Role, content)
+            st.session_state["chat_history"].append(("ai", final_response["answer"])) # (Role, content)
+
+    elif prompt:
         with st.spinner("Generating response..."):
             generated_response = call_go_llm(
                 query=prompt,
@@ -55,19 +124,14 @@ with tab1:
             if generated_response.get("error"):
                 st.error("Error from Go server: " + generated_response["error"])
             else:
-                print(generated_response.keys())
-                sources = set(
-                    [doc["Metadata"]["source"] for doc in generated_response["source_documents"]]
-                )
-
                 formatted_response = (
-                    generated_response["result"] + "\n\n" + create_sources_string(sources)
+                    generated_response["answer"] + "\n\n" + create_sources_string(generated_response)
                 )
 
                 st.session_state["user_prompt_history"].append(prompt)
                 st.session_state["chat_answers_history"].append(formatted_response)
                 st.session_state["chat_history"].append(("human", prompt)) # (Role, content)
-                st.session_state["chat_history"].append(("ai", generated_response["result"])) # (Role, content)
+                st.session_state["chat_history"].append(("ai", generated_response["answer"])) # (Role, content)
 
 
                 if st.session_state["chat_answers_history"]:
@@ -81,27 +145,117 @@ with tab1:
 # Tab 2: Ingest New Documentation
 with tab2:
     st.subheader("Ingest New Documentation")
-    st.write("Enter a URL to crawl and add to the knowledge base.")
-    
-    new_url = st.text_input("Documentation URL", placeholder="https://example.com/docs", key="ingest_url")
-    
-    def ingest_documentation(url: str) -> dict:
+    st.write("Enter a URL to crawl, a local directory or a git repository to add to the knowledge base.")
+
+    source_type = st.radio("Source", ["Website", "Local directory", "Git repository"], horizontal=True, key="ingest_source_type")
+    if source_type == "Website":
+        new_url = st.text_input("Documentation URL", placeholder="https://example.com/docs", key="ingest_url")
+        source_payload = {"url": new_url}
+    elif source_type == "Local directory":
+        new_url = st.text_input("Directory (relative to the server's INGEST_ROOT)", placeholder="docs", key="ingest_path")
+        source_payload = {"path": new_url}
+    else:
+        new_url = st.text_input("Git repository URL", placeholder="https://github.com/org/repo.git", key="ingest_git_url")
+        git_ref = st.text_input("Branch or tag (optional)", key="ingest_git_ref")
+        source_payload = {"git_url": new_url}
+        if git_ref:
+            source_payload["git_ref"] = git_ref
+
+    def ingest_documentation(payload: dict) -> dict:
         try:
-            payload = {"url": url}
             resp = requests.post(f"{GO_SERVER_URL}/ingest", json=payload, timeout=10)
             resp.raise_for_status()
             return resp.json()
         except Exception as e:
             return {"error": str(e)}
     
+    def get_ingestion_status(job_id: str) -> dict:
+        try:
+            resp = requests.get(f"{GO_SERVER_URL}/ingest/{job_id}", timeout=10)
+            resp.raise_for_status()
+            return resp.json()
+        except Exception as e:
+            return {"error": str(e)}
+
+    def cancel_ingestion(job_id: str) -> dict:
+        try:
+            resp = requests.delete(f"{GO_SERVER_URL}/ingest/{job_id}", timeout=120)
+            return resp.json()
+        except Exception as e:
+            return {"error": str(e)}
+
     if st.button("Start Ingestion", type="primary"):
         if new_url:
             with st.spinner("Starting ingestion process..."):
-                result = ingest_documentation(new_url)
+                result = ingest_documentation(source_payload)
                 if result.get("error"):
                     st.error("Error: " + result["error"])
                 else:
+                    st.session_state["ingest_job_id"] = result.get("job_id")
                     st.success(result.get("message", "Ingestion started!"))
                     st.info("The ingestion process is running in the background. This may take several minutes depending on the documentation size.")
         else:
-            st.warning("Please enter a URL to ingest.")
+            st.warning("Please enter a source to ingest.")
+
+    with st.expander("Reset knowledge base"):
+        st.write("Delete documents from the vector store. Leave the source empty to clear everything.")
+        reset_source = st.text_input("Source URL (optional)", placeholder="https://example.com/docs/page", key="reset_source")
+        confirm_reset = st.checkbox("I understand this cannot be undone", key="confirm_reset")
+
+        if st.button("Reset", disabled=not confirm_reset):
+            try:
+                payload = {"confirm": True}
+                if reset_source:
+                    payload["source"] = reset_source
+                resp = requests.post(f"{GO_SERVER_URL}/reset", json=payload, timeout=60)
+                result = resp.json()
+            except Exception as e:
+                result = {"error": str(e)}
+            if result.get("error"):
+                st.error("Error: " + result["error"])
+            else:
+                st.success(f"Deleted {result['deleted']} documents from namespace {result['namespace']}.")
+
+    job_id = st.session_state.get("ingest_job_id")
+    if job_id:
+        st.divider()
+        st.write(f"Ingestion job `{job_id}`")
+        refresh_col, cancel_col = st.columns(2)
+        refresh_col.button("Refresh Status")
+        if cancel_col.button("Cancel Ingestion"):
+            cancelled = cancel_ingestion(job_id)
+            if cancelled.get("error") and not cancelled.get("state"):
+                st.error("Error: " + cancelled["error"])
+        status = get_ingestion_status(job_id)
+        if status.get("error") and not status.get("state"):
+            st.error("Error: " + status["error"])
+        else:
+            st.write(f"**State:** {status['state']}")
+            col1, col2, col3, col4 = st.columns(4)
+            col1.metric("Pages crawled", status.get("pages_crawled", 0))
+            col2.metric("Chunks created", status.get("chunks_created", 0))
+            col3.metric("Batches stored", status.get("batches_stored", 0))
+            col4.metric("Batches failed", status.get("batches_failed", 0))
+            if status["state"] == "failed":
+                st.error("Ingestion failed: " + status.get("error", "unknown error"))
+            elif status["state"] == "cancelled":
+                st.warning(f"Ingestion cancelled after storing {status.get('batches_stored', 0)} batches.")
+            elif status["state"] == "done":
+                result = status.get("result") or {}
+                st.success(
+                    "Ingestion finished: {} added, {} updated, {} unchanged, {} removed chunks.".format(
+                        result.get("chunks_added", 0),
+                        result.get("chunks_updated", 0),
+                        result.get("chunks_unchanged", 0),
+                        result.get("chunks_removed", 0),
+                    )
+                )
+                failed_batches = result.get("failed_batches") or []
+                if failed_batches:
+                    st.warning(
+                        f"{len(failed_batches)} batches could not be stored and will be retried on the next ingest:\n"
+                        + "\n".join(
+                            f"- Batch {batch['batch']} ({batch['chunks']} chunks, {batch['attempts']} attempts): {batch['error']}"
+                            for batch in failed_batches
+                        )
+                    )
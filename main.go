@@ -7,6 +7,11 @@ import (
 	"logging"
 
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/avivnoah/documentation-assistant/server"
 )
@@ -17,8 +22,43 @@ func main() {
 	ctx := context.Background()
 
 	config := server.Config{
-		PineconeHost: os.Getenv("PINECONE_HOST"),
-		Port:         os.Getenv("PORT"),
+		VectorStore:       os.Getenv("VECTOR_STORE"),
+		LocalStorePath:    os.Getenv("LOCAL_STORE_PATH"),
+		ManifestPath:      os.Getenv("MANIFEST_PATH"),
+		KeywordIndexPath:  os.Getenv("KEYWORD_INDEX_PATH"),
+		CollectionsDir:    os.Getenv("COLLECTIONS_DIR"),
+		RetrievalMode:     os.Getenv("RETRIEVAL_MODE"),
+		Reranker:          os.Getenv("RERANKER"),
+		RerankCandidates:  envInt("RERANK_CANDIDATES"),
+		PineconeHost:      os.Getenv("PINECONE_HOST"),
+		PineconeNamespace: os.Getenv("PINECONE_NAMESPACE"),
+		Port:              os.Getenv("PORT"),
+		IngestRoot:        os.Getenv("INGEST_ROOT"),
+		WebCrawler:        os.Getenv("WEB_CRAWLER"),
+		SessionStore:      os.Getenv("SESSION_STORE"),
+		SessionDir:        os.Getenv("SESSION_DIR"),
+		JobsDir:           os.Getenv("JOBS_DIR"),
+		ShutdownTimeout:   time.Duration(envInt("SHUTDOWN_TIMEOUT_MS")) * time.Millisecond,
+
+		LLMProvider:    os.Getenv("LLM_PROVIDER"),
+		LLMModel:       os.Getenv("LLM_MODEL"),
+		LLMModels:      envList("LLM_MODELS"),
+		LLMBaseURL:     os.Getenv("LLM_BASE_URL"),
+		LLMTemperature: envFloat("LLM_TEMPERATURE"),
+		LLMMaxTokens:   envInt("LLM_MAX_TOKENS"),
+
+		MemoryStrategy: os.Getenv("MEMORY_STRATEGY"),
+		MemoryTurns:    envInt("MEMORY_TURNS"),
+		MemoryTokens:   envInt("MEMORY_TOKENS"),
+
+		QueryTimeout: time.Duration(envInt("QUERY_TIMEOUT_MS")) * time.Millisecond,
+
+		RAGPromptFile:      os.Getenv("RAG_PROMPT_FILE"),
+		RephrasePromptFile: os.Getenv("REPHRASE_PROMPT_FILE"),
+
+		EmbeddingProvider: os.Getenv("EMBEDDING_PROVIDER"),
+		EmbeddingModel:    os.Getenv("EMBEDDING_MODEL"),
+		EmbeddingBaseURL:  os.Getenv("EMBEDDING_BASE_URL"),
 	}
 
 	srv, err := server.NewServer(ctx, logger, config)
@@ -28,8 +68,40 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := srv.Start(ctx); err != nil {
+	// SIGINT and SIGTERM start a graceful shutdown of the server
+	serveCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := srv.Start(serveCtx); err != nil {
 		logger.Error(ctx, "Server stopped with error", map[string]any{"error": err.Error()})
 		os.Exit(1)
 	}
 }
+
+// envFloat parses an optional float environment variable, returning nil when unset or invalid
+func envFloat(key string) *float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// envList parses an optional comma-separated environment variable, dropping empty entries
+func envList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// envInt parses an optional integer environment variable, returning 0 when unset or invalid
+func envInt(key string) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return 0
+	}
+	return v
+}
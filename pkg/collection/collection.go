@@ -0,0 +1,176 @@
+// Package collection records the knowledge bases, or collections, a server
+// hosts. Each collection is stored in its own vector store namespace and
+// remembers the embedding model its vectors were made with.
+package collection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by a Registry
+var (
+	ErrNotFound    = errors.New("collection not found")
+	ErrExists      = errors.New("collection already exists")
+	ErrInvalidName = errors.New("collection names must be 1 to 63 lowercase letters, digits, '-' or '_', starting with a letter or digit")
+)
+
+// validName keeps names usable as a Pinecone namespace and a directory name
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Collection is one knowledge base
+type Collection struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"` // Vector store namespace holding the collection's chunks
+
+	// The embedding model is fixed when the collection is created: vectors
+	// made by different models are not comparable
+	EmbeddingProvider string `json:"embedding_provider"`
+	EmbeddingModel    string `json:"embedding_model,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidateName reports whether name can be used for a collection
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// registryFile is the on-disk layout of a Registry
+type registryFile struct {
+	Collections []Collection `json:"collections"`
+}
+
+// Registry keeps the collection records. It is safe for concurrent use.
+type Registry struct {
+	mu          sync.Mutex
+	path        string // Empty keeps the registry in memory only
+	collections map[string]Collection
+}
+
+// NewRegistry creates an empty registry that lives in memory only
+func NewRegistry() *Registry {
+	return &Registry{collections: map[string]Collection{}}
+}
+
+// OpenRegistry loads the registry saved at path, or starts an empty one if
+// the file does not exist. Every change is written back to path.
+func OpenRegistry(path string) (*Registry, error) {
+	r := NewRegistry()
+	r.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection registry: %w", err)
+	}
+
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse collection registry %s: %w", path, err)
+	}
+	for _, c := range file.Collections {
+		r.collections[c.Name] = c
+	}
+	return r, nil
+}
+
+// Create records c, setting its creation time. The namespace defaults to the name.
+func (r *Registry) Create(c Collection) (Collection, error) {
+	if err := ValidateName(c.Name); err != nil {
+		return Collection{}, err
+	}
+	if c.Namespace == "" {
+		c.Namespace = c.Name
+	}
+	c.CreatedAt = time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collections[c.Name]; ok {
+		return Collection{}, fmt.Errorf("%w: %q", ErrExists, c.Name)
+	}
+	r.collections[c.Name] = c
+	if err := r.save(); err != nil {
+		delete(r.collections, c.Name)
+		return Collection{}, err
+	}
+	return c, nil
+}
+
+// Get returns the collection called name, or ErrNotFound
+func (r *Registry) Get(name string) (Collection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.collections[name]
+	if !ok {
+		return Collection{}, fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	return c, nil
+}
+
+// List returns every collection sorted by name
+func (r *Registry) List() []Collection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]Collection, 0, len(r.collections))
+	for _, c := range r.collections {
+		list = append(list, c)
+	}
+	slices.SortFunc(list, func(a, b Collection) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+// Delete removes the record of the collection called name, or returns ErrNotFound
+func (r *Registry) Delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.collections[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	delete(r.collections, name)
+	if err := r.save(); err != nil {
+		r.collections[name] = c
+		return err
+	}
+	return nil
+}
+
+// save atomically writes the registry to r.path. The caller must hold r.mu.
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	file := registryFile{Collections: make([]Collection, 0, len(r.collections))}
+	for _, c := range r.collections {
+		file.Collections = append(file.Collections, c)
+	}
+	slices.SortFunc(file.Collections, func(a, b Collection) int { return strings.Compare(a.Name, b.Name) })
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,185 @@
+package ingestion
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Files of a checkpoint directory. The crawl and split results are written
+// once per stage; stored batches are appended to a log, one number per line,
+// so recording a batch does not rewrite the chunks.
+const (
+	checkpointStateFile   = "state.json"
+	checkpointBatchesFile = "batches.log"
+)
+
+// Checkpoint persists the progress of one ingestion so that a restarted
+// process resumes it instead of starting over: the crawled pages, the chunks
+// and changes computed from them, and the batches already stored. It is safe
+// for concurrent use. The caller removes the directory once the ingestion
+// has ended.
+type Checkpoint struct {
+	mu      sync.Mutex
+	dir     string
+	state   checkpointState
+	batches map[int]bool // Numbers of the stored batches
+}
+
+// checkpointState is the content of the state file
+type checkpointState struct {
+	BaseURL      string            `json:"base_url,omitempty"`
+	Crawled      bool              `json:"crawled"` // Whether the crawl finished, even with no pages
+	PagesCrawled int               `json:"pages_crawled"`
+	Pages        []schema.Document `json:"pages,omitempty"`  // Crawled pages, dropped once split
+	Chunks       []schema.Document `json:"chunks,omitempty"` // Every chunk of the crawl, with its ID
+	Changes      *changeSet        `json:"changes,omitempty"`
+	BatchSize    int               `json:"batch_size,omitempty"` // Batch size the batch numbers refer to
+}
+
+// OpenCheckpoint opens the checkpoint kept in dir, or an empty one when the
+// directory does not exist yet
+func OpenCheckpoint(dir string) (*Checkpoint, error) {
+	c := &Checkpoint{dir: dir, batches: map[int]bool{}}
+
+	data, err := os.ReadFile(filepath.Join(dir, checkpointStateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.state); err != nil {
+		return nil, fmt.Errorf("invalid ingestion checkpoint %s: %w", dir, err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, checkpointBatchesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// A line cut short by a crash is ignored; its batch is stored again
+		if n, err := strconv.Atoi(scanner.Text()); err == nil {
+			c.batches[n] = true
+		}
+	}
+	return c, scanner.Err()
+}
+
+// crawled returns the checkpointed crawl, if the pipeline got that far
+func (c *Checkpoint) crawled() (CrawlResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.state.Crawled {
+		return CrawlResult{}, false
+	}
+	return CrawlResult{BaseURL: c.state.BaseURL, Documents: c.state.Pages}, true
+}
+
+// saveCrawl records the crawled pages
+func (c *Checkpoint) saveCrawl(crawled CrawlResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.BaseURL = crawled.BaseURL
+	c.state.Crawled = true
+	c.state.PagesCrawled = len(crawled.Documents)
+	c.state.Pages = crawled.Documents
+	return c.writeState()
+}
+
+// split returns the checkpointed chunks and changes, if the pipeline got that far
+func (c *Checkpoint) split() (CrawlResult, []schema.Document, changeSet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state.Changes == nil {
+		return CrawlResult{}, nil, changeSet{}, false
+	}
+	// Only the page count of the crawl is kept once it is split
+	crawled := CrawlResult{BaseURL: c.state.BaseURL, Documents: make([]schema.Document, c.state.PagesCrawled)}
+	return crawled, c.state.Chunks, *c.state.Changes, true
+}
+
+// saveSplit records the chunks and the changes to store in batches of
+// batchSize, and drops the crawled pages which are no longer needed
+func (c *Checkpoint) saveSplit(chunks []schema.Document, changes changeSet, batchSize int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Pages = nil
+	c.state.Chunks = chunks
+	c.state.Changes = &changes
+	c.state.BatchSize = batchSize
+	return c.writeState()
+}
+
+// storedBatches returns the numbers of the batches already stored. They only
+// apply to batches of batchSize documents; none are returned for another size.
+func (c *Checkpoint) storedBatches(batchSize int) map[int]bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stored := map[int]bool{}
+	if c.state.BatchSize != batchSize {
+		return stored
+	}
+	for n := range c.batches {
+		stored[n] = true
+	}
+	return stored
+}
+
+// markStored appends a stored batch to the log
+func (c *Checkpoint) markStored(batchNum int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.batches[batchNum] {
+		return nil
+	}
+
+	file, err := os.OpenFile(filepath.Join(c.dir, checkpointBatchesFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(file, batchNum); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	c.batches[batchNum] = true
+	return nil
+}
+
+// writeState replaces the state file. The batch log is cleared with it: its
+// numbers refer to the batches of the previous state.
+func (c *Checkpoint) writeState() error {
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(c.dir, checkpointBatchesFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	c.batches = map[int]bool{}
+
+	path := filepath.Join(c.dir, checkpointStateFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,108 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"logging"
+	"slices"
+	"testing"
+)
+
+// countingCrawler is a pagesCrawler counting its crawls
+type countingCrawler struct {
+	pagesCrawler
+	crawls int
+}
+
+func (c *countingCrawler) Crawl(ctx context.Context, url string, opts Options) (CrawlResult, error) {
+	c.crawls++
+	return c.pagesCrawler.Crawl(ctx, url, opts)
+}
+
+func TestPipelineResumesFromCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	failing := true
+	s, vectors := newTestStore(func(_ context.Context, first string, _ int) error {
+		if failing && first == "gamma" {
+			return errors.New("internal error")
+		}
+		return nil
+	})
+	s.batchSize = 1
+	newPipeline := func(crawler Crawler) *Pipeline {
+		t.Helper()
+		checkpoint, err := OpenCheckpoint(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Pipeline{
+			Crawler:  crawler,
+			Splitter: pageSplitter{},
+			Store:    s,
+			Logger:   logging.New(),
+			Options:  Options{Manifest: NewManifest(), Checkpoint: checkpoint},
+		}
+	}
+
+	// The process stops after storing alpha and beta; the checkpoint keeps
+	// what the next process needs
+	crawler := &countingCrawler{pagesCrawler: pagesCrawler{pages: []string{"alpha", "beta", "gamma"}}}
+	if _, err := newPipeline(crawler).Run(context.Background(), "https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	failing = false
+	vectors.stored = nil
+	result, err := newPipeline(crawler).Run(context.Background(), "https://example.com")
+	if err != nil || len(result.FailedBatches) != 0 {
+		t.Fatalf("resumed Run = %+v, %v", result, err)
+	}
+	if crawler.crawls != 1 {
+		t.Errorf("crawled %d times, want the resumed run to use the checkpointed chunks", crawler.crawls)
+	}
+	if !slices.Equal(vectors.stored, []string{"gamma"}) {
+		t.Errorf("resumed run stored %v, want only the batch not stored before", vectors.stored)
+	}
+	if result.PagesCrawled != 3 || result.ChunksCreated != 3 || result.BatchesStored != 3 {
+		t.Errorf("result = %+v, want the counts of the whole ingestion", result)
+	}
+}
+
+func TestCheckpointKeepsEmptyCrawl(t *testing.T) {
+	dir := t.TempDir()
+	checkpoint, err := OpenCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := checkpoint.crawled(); ok {
+		t.Fatal("new checkpoint reports a crawl")
+	}
+	if err := checkpoint.saveCrawl(CrawlResult{BaseURL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err = OpenCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawled, ok := checkpoint.crawled()
+	if !ok || crawled.BaseURL != "https://example.com" || len(crawled.Documents) != 0 {
+		t.Fatalf("crawled() = %+v, %v, want the crawl without pages", crawled, ok)
+	}
+
+	crawler := &countingCrawler{}
+	s, _ := newTestStore(func(context.Context, string, int) error { return nil })
+	pipeline := &Pipeline{
+		Crawler:  crawler,
+		Splitter: pageSplitter{},
+		Store:    s,
+		Logger:   logging.New(),
+		Options:  Options{Checkpoint: checkpoint},
+	}
+	if _, err := pipeline.Run(context.Background(), "https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if crawler.crawls != 0 {
+		t.Errorf("crawled %d times, want the empty crawl taken from the checkpoint", crawler.crawls)
+	}
+}
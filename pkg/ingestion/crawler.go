@@ -0,0 +1,52 @@
+package ingestion
+
+import (
+	"context"
+	"tavilycrawl"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// CrawlResult holds the pages found by a crawl, one document per page
+type CrawlResult struct {
+	BaseURL   string
+	Documents []schema.Document
+}
+
+// Crawler fetches the pages of a documentation site. Every returned document
+// must carry the page URL in its "source" metadata.
+type Crawler interface {
+	Crawl(ctx context.Context, url string, opts Options) (CrawlResult, error)
+}
+
+// TavilyCrawler crawls sites with the Tavily crawl API
+type TavilyCrawler struct {
+	APIKey string
+}
+
+// Crawl asks Tavily to crawl url within the depth, breadth and page limits of opts
+func (c *TavilyCrawler) Crawl(ctx context.Context, url string, opts Options) (CrawlResult, error) {
+	tavilyCrawl := tavilycrawl.New(tavilycrawl.Options{APIKey: c.APIKey})
+
+	crawlResp, err := tavilyCrawl.CallRaw(ctx, url, tavilycrawl.CrawlParams{
+		MaxDepth:     opts.MaxDepth,
+		Limit:        opts.Limit,
+		MaxBreadth:   opts.MaxBreadth,
+		ExtractDepth: "advanced",
+	})
+	if err != nil {
+		return CrawlResult{}, err
+	}
+
+	docs := make([]schema.Document, 0, len(crawlResp.Results))
+	for _, result := range crawlResp.Results {
+		docs = append(docs, schema.Document{
+			PageContent: result.RawContent,
+			Metadata: map[string]any{
+				"source": result.URL,
+			},
+		})
+	}
+
+	return CrawlResult{BaseURL: crawlResp.BaseURL, Documents: docs}, nil
+}
@@ -0,0 +1,205 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// DefaultDocumentExtensions are the file types DirectoryCrawler reads when no
+// extensions are configured.
+var DefaultDocumentExtensions = []string{".md", ".markdown", ".mdx", ".rst", ".txt", ".adoc", ".html", ".htm"}
+
+// htmlExtensions are converted to text with ExtractHTML, like crawled pages
+var htmlExtensions = []string{".html", ".htm"}
+
+// skippedDirs are never descended into while walking a directory
+var skippedDirs = []string{"node_modules", "vendor"}
+
+// DirectoryCrawler reads documentation files from a local directory. Each file
+// becomes one document whose "source" metadata is the file's absolute path and
+// whose "file_path" metadata is the path relative to the crawled directory.
+// HTML files are converted to text with ExtractHTML and carry their "title".
+// Crawl limits in Options do not apply to directories.
+type DirectoryCrawler struct {
+	Extensions []string
+}
+
+// Crawl walks root and reads every file with a matching extension
+func (c *DirectoryCrawler) Crawl(ctx context.Context, root string, _ Options) (CrawlResult, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return CrawlResult{}, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return CrawlResult{}, err
+	}
+	if !info.IsDir() {
+		return CrawlResult{}, fmt.Errorf("%s is not a directory", root)
+	}
+
+	extensions := c.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultDocumentExtensions
+	}
+
+	var docs []schema.Document
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || slices.Contains(skippedDirs, d.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !d.Type().IsRegular() || !slices.Contains(extensions, ext) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		doc := schema.Document{
+			PageContent: string(content),
+			Metadata: map[string]any{
+				"source":    path,
+				"file_path": filepath.ToSlash(rel),
+			},
+		}
+		if slices.Contains(htmlExtensions, ext) {
+			page, err := ExtractHTML(strings.NewReader(doc.PageContent))
+			if err != nil {
+				return fmt.Errorf("parsing %s: %w", path, err)
+			}
+			doc.PageContent = page.Text
+			if page.Title != "" {
+				doc.Metadata["title"] = page.Title
+			}
+		}
+		docs = append(docs, doc)
+		return nil
+	})
+	if err != nil {
+		return CrawlResult{}, err
+	}
+
+	return CrawlResult{BaseURL: root, Documents: docs}, nil
+}
+
+// GitCrawler shallow-clones a git repository and reads its documentation files
+// with a DirectoryCrawler. Documents carry GitSource of the repository, ref and
+// file as "source", the path relative to the repository root as "file_path",
+// plus "repo" and "commit" metadata.
+type GitCrawler struct {
+	// Ref is an optional branch or tag to check out instead of the default branch
+	Ref       string
+	Directory DirectoryCrawler
+}
+
+// Crawl clones repoURL into a temporary directory, which is removed afterwards
+func (c *GitCrawler) Crawl(ctx context.Context, repoURL string, opts Options) (CrawlResult, error) {
+	if err := ValidateGitURL(repoURL); err != nil {
+		return CrawlResult{}, err
+	}
+
+	dir, err := os.MkdirTemp("", "docs-ingest-git-*")
+	if err != nil {
+		return CrawlResult{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--depth", "1", "--single-branch"}
+	if c.Ref != "" {
+		args = append(args, "--branch", c.Ref)
+	}
+	args = append(args, "--", repoURL, dir)
+	if out, err := gitCommand(ctx, args...).CombinedOutput(); err != nil {
+		return CrawlResult{}, fmt.Errorf("git clone failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	out, err := gitCommand(ctx, "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return CrawlResult{}, fmt.Errorf("failed to resolve cloned commit: %w", err)
+	}
+	commit := strings.TrimSpace(string(out))
+
+	result, err := c.Directory.Crawl(ctx, dir, opts)
+	if err != nil {
+		return CrawlResult{}, err
+	}
+	for _, doc := range result.Documents {
+		doc.Metadata["source"] = GitSource(repoURL, c.Ref, doc.Metadata["file_path"].(string))
+		doc.Metadata["repo"] = repoURL
+		doc.Metadata["commit"] = commit
+	}
+
+	return CrawlResult{BaseURL: repoURL, Documents: result.Documents}, nil
+}
+
+// GitSource returns the "source" of a file read from a git repository,
+// "<repoURL>@<ref>:<path>", or "<repoURL>:<path>" for the default branch, so
+// files with the same path in different repositories or refs stay apart
+func GitSource(repoURL, ref, path string) string {
+	if ref != "" {
+		repoURL += "@" + ref
+	}
+	return repoURL + ":" + path
+}
+
+// gitCommand runs git without ever prompting: credentials or an unknown host
+// key make it fail instead of waiting for input that never comes
+func gitCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	return cmd
+}
+
+// ValidateGitURL accepts https, http, ssh and git URLs as well as scp-like
+// "user@host:path" addresses. Local paths, file:// and helper transports such
+// as ext:: are rejected because they let a request read or execute anything
+// the server can.
+func ValidateGitURL(repoURL string) error {
+	if repoURL == "" || strings.HasPrefix(repoURL, "-") || strings.Contains(repoURL, "::") {
+		return fmt.Errorf("unsupported git URL %q", repoURL)
+	}
+
+	if u, err := url.Parse(repoURL); err == nil && u.Scheme != "" {
+		switch u.Scheme {
+		case "https", "http", "ssh", "git":
+			if u.Host == "" {
+				return fmt.Errorf("git URL %q has no host", repoURL)
+			}
+			return nil
+		default:
+			return fmt.Errorf("unsupported git URL scheme %q", u.Scheme)
+		}
+	}
+
+	// scp-like syntax: user@host:path
+	at, colon := strings.Index(repoURL, "@"), strings.Index(repoURL, ":")
+	if at > 0 && colon > at+1 && colon < len(repoURL)-1 && !strings.Contains(repoURL[:colon], "/") {
+		return nil
+	}
+	return fmt.Errorf("unsupported git URL %q", repoURL)
+}
@@ -0,0 +1,70 @@
+package ingestion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirectoryCrawlerReadsMarkdownAndHTML(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"guide.md":              "# Guide\n\nInstall it.",
+		"api/index.html":        "<html><head><title>API</title></head><body><h1>API</h1><p>Call it.</p><script>x()</script></body></html>",
+		"api/partial.htm":       "<h2>Errors</h2><p>Retry.</p>",
+		"image.png":             "png",
+		".hidden/notes.md":      "hidden",
+		"node_modules/x/doc.md": "dependency",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := (&DirectoryCrawler{}).Crawl(context.Background(), root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := map[string]map[string]any{}
+	contents := map[string]string{}
+	for _, doc := range result.Documents {
+		path := doc.Metadata["file_path"].(string)
+		pages[path] = doc.Metadata
+		contents[path] = doc.PageContent
+	}
+	if len(pages) != 3 {
+		t.Fatalf("crawled %v, want guide.md, api/index.html and api/partial.htm", pages)
+	}
+	if got := pages["api/index.html"]["source"]; got != filepath.Join(root, "api", "index.html") {
+		t.Errorf("source = %v, want the absolute path", got)
+	}
+	if got := pages["api/index.html"]["title"]; got != "API" {
+		t.Errorf("title = %v, want API", got)
+	}
+	if text := contents["api/index.html"]; !strings.Contains(text, "# API") || strings.Contains(text, "<p>") || strings.Contains(text, "x()") {
+		t.Errorf("HTML was not converted to text: %q", text)
+	}
+	if text := contents["api/partial.htm"]; !strings.Contains(text, "## Errors") {
+		t.Errorf("HTML fragment was not converted to text: %q", text)
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	tests := []struct{ repo, ref, path, want string }{
+		{"https://github.com/org/a.git", "", "README.md", "https://github.com/org/a.git:README.md"},
+		{"https://github.com/org/b.git", "", "README.md", "https://github.com/org/b.git:README.md"},
+		{"git@github.com:org/a.git", "v2", "docs/intro.md", "git@github.com:org/a.git@v2:docs/intro.md"},
+	}
+	for _, tt := range tests {
+		if got := GitSource(tt.repo, tt.ref, tt.path); got != tt.want {
+			t.Errorf("GitSource(%q, %q, %q) = %q, want %q", tt.repo, tt.ref, tt.path, got, tt.want)
+		}
+	}
+}
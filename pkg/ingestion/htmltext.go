@@ -0,0 +1,291 @@
+package ingestion
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLPage is the readable content extracted from an HTML document
+type HTMLPage struct {
+	Title string
+	Text  string
+	Links []string // href values in document order, unresolved
+}
+
+// skippedElements never contribute text
+var skippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Nav:      true,
+	atom.Footer:   true,
+	atom.Iframe:   true,
+	atom.Form:     true,
+	atom.Button:   true,
+}
+
+// headingLevels maps heading elements to their markdown depth
+var headingLevels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// blockElements start on a new line
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.Header: true, atom.Aside: true, atom.Ul: true, atom.Ol: true, atom.Table: true,
+	atom.Tr: true, atom.Blockquote: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Figure: true, atom.Hr: true,
+}
+
+// ExtractHTML parses an HTML document and renders its readable text as
+// lightweight markdown: headings become "#" lines, list items "-" bullets and
+// <pre> blocks fenced code, so structure-aware splitters can use them. Headings
+// with an id end in a "{#id}" attribute so chunks can link to the section.
+func ExtractHTML(r io.Reader) (HTMLPage, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return HTMLPage{}, err
+	}
+
+	e := &htmlExtractor{}
+	e.walk(root)
+	return HTMLPage{
+		Title: collapseSpaces(strings.TrimSpace(e.title)),
+		Text:  normalizeBlankLines(e.out.String()),
+		Links: collectLinks(root),
+	}, nil
+}
+
+type htmlExtractor struct {
+	out   strings.Builder
+	title string
+}
+
+// collectLinks returns every <a href> in the document, including those in
+// navigation elements that are left out of the text
+func collectLinks(root *html.Node) []string {
+	var links []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			if href := attr(n, "href"); href != "" {
+				links = append(links, href)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return links
+}
+
+func (e *htmlExtractor) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		e.writeText(n.Data)
+		return
+	case html.ElementNode:
+		if n.DataAtom == atom.Title && e.title == "" {
+			e.title = textContent(n)
+			return
+		}
+		if n.DataAtom == atom.Head {
+			// The title lives in <head>; nothing else there is readable text
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.DataAtom == atom.Title {
+					e.title = textContent(c)
+				}
+			}
+			return
+		}
+		if skippedElements[n.DataAtom] {
+			return
+		}
+		if level, ok := headingLevels[n.DataAtom]; ok {
+			e.block()
+			e.out.WriteString(strings.Repeat("#", level) + " " + strings.TrimSpace(collapseSpaces(textContent(n))))
+			if id := headingID(n); id != "" && !strings.ContainsAny(id, " }") {
+				e.out.WriteString(" {#" + id + "}")
+			}
+			e.block()
+			return
+		}
+		switch n.DataAtom {
+		case atom.Pre:
+			e.block()
+			e.out.WriteString("```" + codeLanguage(n) + "\n")
+			e.out.WriteString(strings.TrimRight(textContent(n), "\n"))
+			e.out.WriteString("\n```")
+			e.block()
+			return
+		case atom.Br:
+			e.out.WriteString("\n")
+			return
+		case atom.Li:
+			e.line()
+			e.out.WriteString("- ")
+		case atom.Td, atom.Th:
+			e.out.WriteString(" | ")
+		case atom.Code:
+			e.out.WriteString("`" + textContent(n) + "`")
+			return
+		}
+		if blockElements[n.DataAtom] {
+			e.block()
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		e.walk(c)
+	}
+
+	if n.Type == html.ElementNode && (blockElements[n.DataAtom] || n.DataAtom == atom.Li) {
+		e.line()
+	}
+}
+
+// writeText appends inline text with whitespace collapsed
+func (e *htmlExtractor) writeText(s string) {
+	text := collapseSpaces(s)
+	if text == "" || text == " " {
+		if text == " " && !strings.HasSuffix(e.out.String(), " ") && !strings.HasSuffix(e.out.String(), "\n") && e.out.Len() > 0 {
+			e.out.WriteString(" ")
+		}
+		return
+	}
+	e.out.WriteString(text)
+}
+
+// line ends the current line if it has content
+func (e *htmlExtractor) line() {
+	if e.out.Len() > 0 && !strings.HasSuffix(e.out.String(), "\n") {
+		e.out.WriteString("\n")
+	}
+}
+
+// block separates the next content by a blank line
+func (e *htmlExtractor) block() {
+	if e.out.Len() == 0 {
+		return
+	}
+	e.line()
+	if !strings.HasSuffix(e.out.String(), "\n\n") {
+		e.out.WriteString("\n")
+	}
+}
+
+// headingID returns the id of a heading, or of an anchor inside it
+func headingID(n *html.Node) string {
+	if id := attr(n, "id"); id != "" {
+		return id
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			if id := attr(c, "id"); id != "" {
+				return id
+			}
+			if name := attr(c, "name"); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// codeLanguage reads a "language-xxx" class from a <pre> or its <code> child
+func codeLanguage(n *html.Node) string {
+	for _, node := range []*html.Node{n, n.FirstChild} {
+		if node == nil || node.Type != html.ElementNode {
+			continue
+		}
+		for _, class := range strings.Fields(attr(node, "class")) {
+			if lang, ok := strings.CutPrefix(class, "language-"); ok {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// collapseSpaces replaces every run of whitespace with a single space
+func collapseSpaces(s string) string {
+	if s == "" {
+		return ""
+	}
+	fields := strings.Fields(s)
+	out := strings.Join(fields, " ")
+	if len(fields) == 0 {
+		return " "
+	}
+	if isSpace(s[0]) {
+		out = " " + out
+	}
+	if isSpace(s[len(s)-1]) {
+		out += " "
+	}
+	return out
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\r' || c == '\f'
+}
+
+// normalizeBlankLines trims lines and keeps at most one blank line in a row.
+// Lines inside fenced code blocks keep their indentation and blank lines.
+func normalizeBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank, inFence := false, false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			line = strings.TrimSpace(line)
+		} else if inFence {
+			out = append(out, strings.TrimRight(line, " \t"))
+			blank = false
+			continue
+		} else {
+			line = strings.TrimSpace(line)
+		}
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
@@ -0,0 +1,512 @@
+// Package ingestion implements the documentation ingestion pipeline: pages are
+// crawled, split into chunks, embedded and stored in a vector store.
+package ingestion
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"logging"
+	"os"
+	"time"
+
+	"github.com/avivnoah/documentation-assistant/pkg/keyword"
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// Stage identifies the step the pipeline is currently executing
+type Stage string
+
+const (
+	StageCrawling  Stage = "crawling"
+	StageSplitting Stage = "splitting"
+	StageEmbedding Stage = "embedding"
+)
+
+// Progress receives updates while the pipeline runs. Implementations must be
+// safe for concurrent use because batches are stored by several workers.
+type Progress interface {
+	Stage(stage Stage)
+	PagesCrawled(n int)
+	ChunksCreated(n int)
+	BatchStored(batchNum, size int)
+	// BatchFailed is called for a batch that could not be stored after every retry
+	BatchFailed(batchNum, size int, err error)
+}
+
+// Options configures every stage of the pipeline
+type Options struct {
+	// Crawl
+	MaxDepth   int
+	Limit      int
+	MaxBreadth int
+	// Include and Exclude are regular expressions matched against discovered
+	// URLs by the native web crawler; Exclude wins over Include
+	Include         []string
+	Exclude         []string
+	AllowOtherHosts bool // Follow links to hosts other than the start URL's
+	// WebCrawler selects the crawler for websites, one of the WebCrawler*
+	// constants. Empty uses Tavily when TAVILY_API_KEY is set, else the native crawler.
+	WebCrawler string
+
+	// Tags are stored in the TagsKey metadata of every chunk so queries can filter on them
+	Tags []string
+
+	// Split
+	ChunkSize    int
+	ChunkOverlap int
+	// Splitter is one of the Splitter* constants; empty uses SplitterMarkdown
+	Splitter string
+
+	// Store
+	BatchSize int
+	// Workers is the initial number of batches stored at once. It adapts to
+	// the provider's rate limits, between 1 and MaxWorkers.
+	Workers    int
+	MaxWorkers int
+	MaxRetries int // Retries of a failing batch, with exponential backoff
+	// BatchTimeout bounds one attempt to store a batch; a timed out attempt
+	// is retried
+	BatchTimeout time.Duration
+
+	// Progress is notified as the pipeline advances; may be nil
+	Progress Progress
+	// Manifest, when set, makes re-ingesting a source incremental: only new or
+	// changed chunks are embedded and chunks of vanished pages are deleted
+	Manifest *Manifest
+	// KeywordIndex, when set, receives every chunk of the source alongside
+	// the vector store, so chunks ingested before it existed are indexed too
+	KeywordIndex *keyword.Index
+	// Checkpoint, when set, records the crawl, the chunks and the stored
+	// batches as the pipeline advances, and a run with a checkpoint left by
+	// an unfinished run resumes from the last stage and batch it recorded
+	Checkpoint *Checkpoint
+}
+
+// DefaultOptions returns the settings the assistant has always ingested with
+func DefaultOptions() Options {
+	return Options{
+		MaxDepth:     1,
+		Limit:        100,
+		MaxBreadth:   15,
+		ChunkSize:    4000,
+		ChunkOverlap: 200,
+		BatchSize:    50,
+		Workers:      5, // Adapts to rate limits, up to MaxWorkers
+		MaxWorkers:   10,
+		MaxRetries:   5,
+		BatchTimeout: 2 * time.Minute,
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	d := DefaultOptions()
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = d.MaxDepth
+	}
+	if o.Limit <= 0 {
+		o.Limit = d.Limit
+	}
+	if o.MaxBreadth <= 0 {
+		o.MaxBreadth = d.MaxBreadth
+	}
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = d.ChunkSize
+	}
+	if o.ChunkOverlap < 0 || o.ChunkOverlap >= o.ChunkSize {
+		o.ChunkOverlap = d.ChunkOverlap
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = d.BatchSize
+	}
+	if o.Workers <= 0 {
+		o.Workers = d.Workers
+	}
+	if o.MaxWorkers <= 0 {
+		o.MaxWorkers = max(d.MaxWorkers, o.Workers)
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = d.MaxRetries
+	}
+	if o.BatchTimeout <= 0 {
+		o.BatchTimeout = d.BatchTimeout
+	}
+	return o
+}
+
+// Result summarizes a completed ingestion
+type Result struct {
+	BaseURL       string `json:"base_url"`
+	PagesCrawled  int    `json:"pages_crawled"`
+	ChunksCreated int    `json:"chunks_created"`
+	BatchesStored int    `json:"batches_stored"`
+
+	// Chunk changes compared with the previous ingest of the same source.
+	// Without a manifest every chunk counts as added.
+	ChunksAdded     int `json:"chunks_added"`
+	ChunksUpdated   int `json:"chunks_updated"`
+	ChunksUnchanged int `json:"chunks_unchanged"`
+	ChunksRemoved   int `json:"chunks_removed"`
+
+	// FailedBatches lists the batches that could not be stored after every
+	// retry. The ingest still succeeds; their chunks are stored by the next
+	// ingest of the source.
+	FailedBatches []FailedBatch `json:"failed_batches,omitempty"`
+}
+
+// Source identifies what to ingest. Exactly one of URL, Path and GitURL must be set.
+type Source struct {
+	URL    string // Documentation site crawled over HTTP
+	Path   string // Local directory of documentation files
+	GitURL string // Git repository cloned and read like a local directory
+	GitRef string // Optional branch or tag of GitURL
+}
+
+// Validate checks that exactly one location is set
+func (s Source) Validate() error {
+	set := 0
+	for _, v := range []string{s.URL, s.Path, s.GitURL} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("exactly one of url, path or git_url is required")
+	}
+	if s.GitRef != "" && s.GitURL == "" {
+		return errors.New("git_ref requires git_url")
+	}
+	if s.GitURL != "" {
+		return ValidateGitURL(s.GitURL)
+	}
+	return nil
+}
+
+// String returns the location being ingested, which is also the key of the
+// source in the manifest. Git sources are qualified with their ref, as in
+// GitSource, so ingesting several refs of a repository keeps each one's chunks.
+func (s Source) String() string {
+	if s.GitURL != "" && s.GitRef != "" {
+		return s.GitURL + "@" + s.GitRef
+	}
+	return s.location()
+}
+
+// location returns the URL, directory or repository the crawler reads
+func (s Source) location() string {
+	switch {
+	case s.Path != "":
+		return s.Path
+	case s.GitURL != "":
+		return s.GitURL
+	default:
+		return s.URL
+	}
+}
+
+// crawler returns the default crawler for the kind of source
+func (s Source) crawler(opts Options) (Crawler, error) {
+	switch {
+	case s.Path != "":
+		return &DirectoryCrawler{}, nil
+	case s.GitURL != "":
+		return &GitCrawler{Ref: s.GitRef}, nil
+	}
+
+	apiKey := os.Getenv("TAVILY_API_KEY")
+	switch opts.WebCrawler {
+	case WebCrawlerTavily:
+		return &TavilyCrawler{APIKey: apiKey}, nil
+	case WebCrawlerNative:
+		return &WebCrawler{}, nil
+	case "":
+		if apiKey != "" {
+			return &TavilyCrawler{APIKey: apiKey}, nil
+		}
+		return &WebCrawler{}, nil
+	default:
+		return nil, fmt.Errorf("unknown web crawler %q", opts.WebCrawler)
+	}
+}
+
+// Pipeline wires the crawl, split and store stages together
+type Pipeline struct {
+	Crawler  Crawler
+	Splitter Splitter
+	Store    *Store
+	Logger   logging.Logger
+	Options  Options
+
+	// ManifestKey is the key of the source in Options.Manifest; empty uses
+	// the url passed to Run
+	ManifestKey string
+}
+
+// Run ingests the documentation found at url, which is interpreted by the Crawler.
+// Chunks are stored under IDs derived from their page and content, so storing
+// a chunk again overwrites it; with Options.Manifest only changes are stored.
+func (p *Pipeline) Run(ctx context.Context, url string) (Result, error) {
+	logger := p.Logger
+	progress := p.Options.Progress
+	if progress == nil {
+		progress = noopProgress{}
+	}
+
+	var crawled CrawlResult
+	var chunks []schema.Document
+	var changes changeSet
+	resumed := false
+	checkpoint := p.Options.Checkpoint
+	if checkpoint != nil {
+		crawled, chunks, changes, resumed = checkpoint.split()
+	}
+	if resumed {
+		logger.Info(ctx, "Resuming ingestion from checkpoint", map[string]any{
+			"url":           url,
+			"pages_crawled": len(crawled.Documents),
+			"total_chunks":  len(chunks),
+		})
+		progress.PagesCrawled(len(crawled.Documents))
+		progress.ChunksCreated(len(chunks))
+	} else {
+		var err error
+		if crawled, err = p.crawl(ctx, url, progress); err != nil {
+			return Result{}, err
+		}
+		if chunks, changes, err = p.split(ctx, p.manifestKey(url), crawled, progress); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return Result{BaseURL: crawled.BaseURL, PagesCrawled: len(crawled.Documents), ChunksCreated: len(chunks)}, context.Cause(ctx)
+	}
+
+	progress.Stage(StageEmbedding)
+	var stored map[int]bool
+	if checkpoint != nil {
+		stored = checkpoint.storedBatches(p.Store.batchSize)
+		progress = checkpointProgress{Progress: progress, checkpoint: checkpoint, logger: logger}
+	}
+	batches, failed, err := p.Store.Add(ctx, changes.Add, progress, stored)
+	result := Result{
+		BaseURL:         crawled.BaseURL,
+		PagesCrawled:    len(crawled.Documents),
+		ChunksCreated:   len(chunks),
+		BatchesStored:   batches,
+		ChunksAdded:     changes.Added,
+		ChunksUpdated:   changes.Updated,
+		ChunksUnchanged: changes.Unchanged,
+		ChunksRemoved:   changes.Removed,
+		FailedBatches:   failed,
+	}
+	if err != nil {
+		return result, err
+	}
+	if len(failed) > 0 {
+		var previous map[string][]string
+		if p.Options.Manifest != nil {
+			previous = p.Options.Manifest.pages(p.manifestKey(url))
+		}
+		var failedIDs map[string]bool
+		chunks, failedIDs = withoutFailedBatches(chunks, changes.Add, failed, p.Store.batchSize)
+		changes = changes.withoutFailed(failedIDs, previous)
+	}
+
+	if p.Options.Manifest != nil {
+		// Stale chunks are only removed once their replacements are stored
+		if err := p.Store.DeleteIDs(ctx, changes.Delete); err != nil {
+			logger.Error(ctx, "Failed to delete stale chunks", map[string]any{"error": err.Error()})
+			return result, err
+		}
+		if err := p.Options.Manifest.update(p.manifestKey(url), changes.Pages); err != nil {
+			logger.Error(ctx, "Failed to save ingestion manifest", map[string]any{"error": err.Error()})
+			return result, err
+		}
+	}
+
+	if p.Options.KeywordIndex != nil {
+		if err := p.Options.KeywordIndex.Update(chunks, changes.Delete); err != nil {
+			logger.Error(ctx, "Failed to update keyword index", map[string]any{"error": err.Error()})
+			return result, err
+		}
+	}
+
+	logger.Info(ctx, "PIPELINE COMPLETED, INGESTION FINISHED SUCCESSFULLY.", map[string]any{
+		"base_url":         result.BaseURL,
+		"pages_crawled":    result.PagesCrawled,
+		"chunks_created":   result.ChunksCreated,
+		"chunks_added":     result.ChunksAdded,
+		"chunks_updated":   result.ChunksUpdated,
+		"chunks_unchanged": result.ChunksUnchanged,
+		"chunks_removed":   result.ChunksRemoved,
+	})
+	return result, nil
+}
+
+// manifestKey returns the key under which the pages crawled from url are recorded
+func (p *Pipeline) manifestKey(url string) string {
+	return cmp.Or(p.ManifestKey, url)
+}
+
+// crawl fetches the pages at url, or takes them from the checkpoint of an
+// earlier run that was interrupted before they were split
+func (p *Pipeline) crawl(ctx context.Context, url string, progress Progress) (CrawlResult, error) {
+	logger := p.Logger
+	checkpoint := p.Options.Checkpoint
+	if checkpoint != nil {
+		if crawled, ok := checkpoint.crawled(); ok {
+			logger.Info(ctx, "Resuming ingestion from checkpointed crawl", map[string]any{"url": url, "pages_crawled": len(crawled.Documents)})
+			progress.PagesCrawled(len(crawled.Documents))
+			return crawled, nil
+		}
+	}
+
+	logger.Info(ctx, "Starting to crawl documentation", map[string]any{"url": url})
+	progress.Stage(StageCrawling)
+	crawled, err := p.Crawler.Crawl(ctx, url, p.Options)
+	if err != nil {
+		logger.Error(ctx, "Crawl failed", map[string]any{"error": err.Error(), "url": url})
+		return CrawlResult{}, err
+	}
+	progress.PagesCrawled(len(crawled.Documents))
+	logger.Info(ctx, "Successfully crawled the documentation site", map[string]any{
+		"base_url":      crawled.BaseURL,
+		"pages_crawled": len(crawled.Documents),
+	})
+
+	if checkpoint != nil {
+		if err := checkpoint.saveCrawl(crawled); err != nil {
+			logger.Error(ctx, "Failed to checkpoint crawled pages", map[string]any{"error": err.Error()})
+		}
+	}
+	return crawled, nil
+}
+
+// split cuts the crawled pages into chunks and compares them with the pages
+// recorded under key in the manifest, recording the result in the checkpoint
+func (p *Pipeline) split(ctx context.Context, key string, crawled CrawlResult, progress Progress) ([]schema.Document, changeSet, error) {
+	logger := p.Logger
+	progress.Stage(StageSplitting)
+	chunks, err := p.Splitter.Split(crawled.Documents)
+	if err != nil {
+		logger.Error(ctx, "Failed to split documents", map[string]any{"error": err.Error()})
+		return nil, changeSet{}, err
+	}
+	stampChunks(chunks, p.Options.Tags, time.Now())
+	chunks = assignChunkIDs(chunks)
+	progress.ChunksCreated(len(chunks))
+	logger.Info(ctx, "Successfully split all documents into chunks", map[string]any{
+		"total_documents": len(crawled.Documents),
+		"total_chunks":    len(chunks),
+	})
+
+	changes := changeSet{Add: chunks, Added: len(chunks)}
+	if p.Options.Manifest != nil {
+		changes = diffChunks(chunks, p.Options.Manifest.pages(key))
+		logger.Info(ctx, "Compared chunks with the previous ingest", map[string]any{
+			"added":     changes.Added,
+			"updated":   changes.Updated,
+			"unchanged": changes.Unchanged,
+			"removed":   changes.Removed,
+		})
+	}
+
+	if checkpoint := p.Options.Checkpoint; checkpoint != nil {
+		if err := checkpoint.saveSplit(chunks, changes, p.Store.batchSize); err != nil {
+			logger.Error(ctx, "Failed to checkpoint chunks", map[string]any{"error": err.Error()})
+		}
+	}
+	return chunks, changes, nil
+}
+
+// checkpointProgress records every stored batch in a checkpoint before
+// passing it on
+type checkpointProgress struct {
+	Progress
+	checkpoint *Checkpoint
+	logger     logging.Logger
+}
+
+func (p checkpointProgress) BatchStored(batchNum, size int) {
+	if err := p.checkpoint.markStored(batchNum); err != nil {
+		// The batch is stored again if the ingestion resumes
+		p.logger.Error(context.Background(), "Failed to checkpoint stored batch", map[string]any{"error": err.Error(), "batch": batchNum})
+	}
+	p.Progress.BatchStored(batchNum, size)
+}
+
+// Ingest crawls source, splits the pages into chunks and stores them in store.
+// Sites are crawled with Tavily or WebCrawler, local directories and git
+// repositories are read from disk.
+func Ingest(ctx context.Context, logger logging.Logger, store *vectorstores.VectorStore, source Source, opts Options) (Result, error) {
+	if err := source.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	opts = opts.withDefaults()
+	crawler, err := source.crawler(opts)
+	if err != nil {
+		return Result{}, err
+	}
+	var splitter Splitter
+	switch opts.Splitter {
+	case "", SplitterMarkdown:
+		splitter = NewMarkdownSplitter(opts.ChunkSize, opts.ChunkOverlap)
+	case SplitterRecursive:
+		splitter = NewTextSplitter(opts.ChunkSize, opts.ChunkOverlap)
+	default:
+		return Result{}, fmt.Errorf("unknown splitter %q", opts.Splitter)
+	}
+	pipeline := &Pipeline{
+		Crawler:  crawler,
+		Splitter: splitter,
+		Store:    newStore(*store, opts, logger),
+		Logger:   logger,
+		Options:  opts,
+
+		ManifestKey: source.String(),
+	}
+	return pipeline.Run(ctx, source.location())
+}
+
+// newStore creates the Store stage configured by opts
+func newStore(store vectorstores.VectorStore, opts Options, logger logging.Logger) *Store {
+	s := NewStore(store, opts.BatchSize, opts.Workers, logger)
+	s.MaxWorkers = opts.MaxWorkers
+	s.MaxRetries = opts.MaxRetries
+	s.BatchTimeout = opts.BatchTimeout
+	return s
+}
+
+// withoutFailedBatches drops the chunks of the failed batches of add from
+// chunks, so that they are not indexed, and returns their IDs
+func withoutFailedBatches(chunks, add []schema.Document, failed []FailedBatch, batchSize int) ([]schema.Document, map[string]bool) {
+	failedIDs := map[string]bool{}
+	for _, batch := range failed {
+		start := (batch.Batch - 1) * batchSize
+		for _, chunk := range add[start:min(start+batchSize, len(add))] {
+			id, _ := chunk.Metadata[vectorstore.ChunkIDKey].(string)
+			failedIDs[id] = true
+		}
+	}
+	kept := make([]schema.Document, 0, len(chunks))
+	for _, chunk := range chunks {
+		if id, _ := chunk.Metadata[vectorstore.ChunkIDKey].(string); !failedIDs[id] {
+			kept = append(kept, chunk)
+		}
+	}
+	return kept, failedIDs
+}
+
+type noopProgress struct{}
+
+func (noopProgress) Stage(Stage)                 {}
+func (noopProgress) PagesCrawled(int)            {}
+func (noopProgress) ChunksCreated(int)           {}
+func (noopProgress) BatchStored(int, int)        {}
+func (noopProgress) BatchFailed(int, int, error) {}
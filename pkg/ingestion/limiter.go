@@ -0,0 +1,70 @@
+package ingestion
+
+import (
+	"context"
+	"sync"
+)
+
+// concurrencyLimiter bounds the batches stored at once with an adaptive
+// limit: it halves when the provider rate limits a request and grows by one
+// after a full window of successful requests, between 1 and max.
+type concurrencyLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	max       int
+	active    int
+	successes int           // Successes since the limit last changed
+	changed   chan struct{} // Closed and replaced when a slot may have freed up
+}
+
+func newConcurrencyLimiter(initial, max int) *concurrencyLimiter {
+	return &concurrencyLimiter{limit: min(initial, max), max: max, changed: make(chan struct{})}
+}
+
+// acquire waits for a free slot
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// release frees a slot and adapts the limit to how the request went. It
+// returns the new limit when it changed, and 0 otherwise.
+func (l *concurrencyLimiter) release(succeeded, rateLimited bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+
+	previous := l.limit
+	switch {
+	case rateLimited:
+		l.limit = max(l.limit/2, 1)
+		l.successes = 0
+	case succeeded:
+		l.successes++
+		if l.successes >= l.limit && l.limit < l.max {
+			l.limit++
+			l.successes = 0
+		}
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+	if l.limit == previous {
+		return 0
+	}
+	return l.limit
+}
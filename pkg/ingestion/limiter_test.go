@@ -0,0 +1,86 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterAdapts(t *testing.T) {
+	ctx := context.Background()
+	l := newConcurrencyLimiter(4, 6)
+
+	acquire := func(n int) {
+		t.Helper()
+		for range n {
+			if err := l.acquire(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	acquire(4)
+	if got := l.release(false, true); got != 2 {
+		t.Fatalf("limit after a rate limited request = %d, want 2", got)
+	}
+	l.release(false, true)
+	l.release(false, true)
+	if got := l.release(false, true); got != 0 {
+		t.Fatalf("limit changed to %d below 1", got)
+	}
+	if l.limit != 1 {
+		t.Fatalf("limit = %d, want 1", l.limit)
+	}
+
+	// The limit grows by one after a window of successes, up to max
+	for want := 2; want <= 6; want++ {
+		for i := 1; i < want-1; i++ {
+			acquire(1)
+			if got := l.release(true, false); got != 0 {
+				t.Fatalf("limit grew to %d after %d of %d successes", got, i, want-1)
+			}
+		}
+		acquire(1)
+		if got := l.release(true, false); got != want {
+			t.Fatalf("limit after a window of successes = %d, want %d", got, want)
+		}
+	}
+	for range 20 {
+		acquire(1)
+		if got := l.release(true, false); got != 0 {
+			t.Fatalf("limit grew to %d past max", got)
+		}
+	}
+
+	// A failure that is not rate limited leaves the limit alone
+	acquire(1)
+	if got := l.release(false, false); got != 0 {
+		t.Fatalf("limit changed to %d after a plain failure", got)
+	}
+}
+
+func TestConcurrencyLimiterBlocks(t *testing.T) {
+	l := newConcurrencyLimiter(1, 1)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire past the limit = %v, want to wait until the deadline", err)
+	}
+
+	acquired := make(chan error)
+	go func() { acquired <- l.acquire(context.Background()) }()
+	l.release(true, false)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("release did not wake a waiting acquire")
+	}
+}
@@ -0,0 +1,290 @@
+package ingestion
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// ContentHashKey is the chunk metadata holding the SHA-256 of the chunk text.
+// The chunk's ID is stored under vectorstore.ChunkIDKey.
+const ContentHashKey = "content_hash"
+
+// Manifest records which chunks were stored for every ingested source, so a
+// re-ingest only embeds new or changed chunks and deletes the ones whose
+// pages vanished. It is safe for concurrent use.
+type Manifest struct {
+	mu      sync.Mutex
+	path    string // Empty keeps the manifest in memory only
+	sources map[string]sourceManifest
+}
+
+// sourceManifest lists the chunk IDs stored for each page of one source
+type sourceManifest struct {
+	Pages     map[string][]string `json:"pages"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// manifestFile is the on-disk layout of a Manifest
+type manifestFile struct {
+	Sources map[string]sourceManifest `json:"sources"`
+}
+
+// NewManifest creates an empty manifest that lives in memory only
+func NewManifest() *Manifest {
+	return &Manifest{sources: map[string]sourceManifest{}}
+}
+
+// OpenManifest loads the manifest saved at path, or starts an empty one if
+// the file does not exist. Every change is written back to path.
+func OpenManifest(path string) (*Manifest, error) {
+	m := NewManifest()
+	m.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ingestion manifest: %w", err)
+	}
+
+	var file manifestFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse ingestion manifest %s: %w", path, err)
+	}
+	if file.Sources != nil {
+		m.sources = file.Sources
+	}
+	return m, nil
+}
+
+// pages returns a copy of the chunk IDs recorded for source, keyed by page
+func (m *Manifest) pages(source string) map[string][]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pages := map[string][]string{}
+	for page, ids := range m.sources[source].Pages {
+		pages[page] = slices.Clone(ids)
+	}
+	return pages
+}
+
+// update replaces the chunk IDs recorded for source
+func (m *Manifest) update(source string, pages map[string][]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sources[source] = sourceManifest{Pages: pages, UpdatedAt: time.Now()}
+	return m.save()
+}
+
+// PageIDs returns the chunk IDs recorded for the pages whose URL or path
+// equals page, in every source
+func (m *Manifest) PageIDs(page string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	for _, sm := range m.sources {
+		ids = append(ids, sm.Pages[page]...)
+	}
+	return ids
+}
+
+// Forget drops the pages whose URL or path equals page from every source, or
+// the whole manifest when page is empty. Call it after deleting the matching
+// documents from the vector store so they are embedded again on the next ingest.
+func (m *Manifest) Forget(page string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if page == "" {
+		clear(m.sources)
+		return m.save()
+	}
+	for source, sm := range m.sources {
+		if _, ok := sm.Pages[page]; ok {
+			delete(sm.Pages, page)
+			m.sources[source] = sm
+		}
+	}
+	return m.save()
+}
+
+// save atomically writes the manifest to m.path. The caller must hold m.mu.
+func (m *Manifest) save() error {
+	if m.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(manifestFile{Sources: m.sources})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// changeSet is the difference between the chunks of a new crawl and the ones
+// recorded in the manifest
+type changeSet struct {
+	Add    []schema.Document   // Chunks to embed and store
+	Delete []string            // IDs of stored chunks that are no longer current
+	Pages  map[string][]string // Chunk IDs per page after the change
+
+	Added     int
+	Updated   int
+	Unchanged int
+	Removed   int
+}
+
+// assignChunkIDs sets vectorstore.ChunkIDKey and ContentHashKey on every
+// chunk. The ID is derived from the page's source, the chunk content and its
+// tags, so unchanged chunks keep their ID across ingests while retagged ones
+// are stored again. Chunks repeated verbatim on one page are dropped.
+func assignChunkIDs(chunks []schema.Document) []schema.Document {
+	seen := make(map[string]bool, len(chunks))
+	out := chunks[:0]
+	for _, chunk := range chunks {
+		page, _ := chunk.Metadata["source"].(string)
+		contentHash := sha256.Sum256([]byte(chunk.PageContent))
+		hash := hex.EncodeToString(contentHash[:])
+		key := page + "\x00" + hash
+		if tags, ok := chunk.Metadata[TagsKey].([]any); ok {
+			for _, tag := range tags {
+				key += "\x00" + fmt.Sprint(tag)
+			}
+		}
+		id := sha256.Sum256([]byte(key))
+		chunkID := hex.EncodeToString(id[:])
+
+		if seen[chunkID] {
+			continue
+		}
+		seen[chunkID] = true
+		if chunk.Metadata == nil {
+			chunk.Metadata = map[string]any{}
+		}
+		chunk.Metadata[vectorstore.ChunkIDKey] = chunkID
+		chunk.Metadata[ContentHashKey] = hash
+		out = append(out, chunk)
+	}
+	return out
+}
+
+// diffChunks compares chunks, which must carry vectorstore.ChunkIDKey, with
+// the pages previously recorded for the source. Within a page that existed
+// before, a new chunk paired with a vanished one counts as updated; the
+// remaining new chunks count as added and the remaining vanished ones as removed.
+func diffChunks(chunks []schema.Document, previous map[string][]string) changeSet {
+	changes := changeSet{Pages: map[string][]string{}}
+
+	newIDs := map[string]bool{}
+	pageChunks := map[string][]schema.Document{}
+	var pageOrder []string
+	for _, chunk := range chunks {
+		page, _ := chunk.Metadata["source"].(string)
+		id, _ := chunk.Metadata[vectorstore.ChunkIDKey].(string)
+		if _, ok := pageChunks[page]; !ok {
+			pageOrder = append(pageOrder, page)
+		}
+		pageChunks[page] = append(pageChunks[page], chunk)
+		changes.Pages[page] = append(changes.Pages[page], id)
+		newIDs[id] = true
+	}
+
+	for _, page := range pageOrder {
+		oldIDs := map[string]bool{}
+		for _, id := range previous[page] {
+			oldIDs[id] = true
+		}
+
+		fresh := 0
+		for _, chunk := range pageChunks[page] {
+			if oldIDs[chunk.Metadata[vectorstore.ChunkIDKey].(string)] {
+				changes.Unchanged++
+				continue
+			}
+			fresh++
+			changes.Add = append(changes.Add, chunk)
+		}
+		stale := 0
+		for _, id := range previous[page] {
+			if !newIDs[id] {
+				stale++
+				changes.Delete = append(changes.Delete, id)
+			}
+		}
+
+		updated := min(fresh, stale)
+		changes.Updated += updated
+		changes.Added += fresh - updated
+		changes.Removed += stale - updated
+	}
+
+	for page, ids := range previous {
+		if _, ok := pageChunks[page]; ok {
+			continue
+		}
+		changes.Removed += len(ids)
+		changes.Delete = append(changes.Delete, ids...)
+	}
+	return changes
+}
+
+// withoutFailed removes the chunks that could not be stored from the change
+// set. They are left out of the manifest, so the next ingest stores them
+// again, and the stale chunks of their pages are kept until then.
+func (c changeSet) withoutFailed(failed map[string]bool, previous map[string][]string) changeSet {
+	keep := map[string]bool{}
+	pages := make(map[string][]string, len(c.Pages))
+	for page, ids := range c.Pages {
+		var stored []string
+		for _, id := range ids {
+			if !failed[id] {
+				stored = append(stored, id)
+			}
+		}
+		if len(stored) < len(ids) {
+			current := map[string]bool{}
+			for _, id := range ids {
+				current[id] = true
+			}
+			for _, id := range previous[page] {
+				if !current[id] {
+					keep[id] = true
+					stored = append(stored, id)
+				}
+			}
+		}
+		pages[page] = stored
+	}
+
+	var deletes []string
+	for _, id := range c.Delete {
+		if !keep[id] {
+			deletes = append(deletes, id)
+		}
+	}
+	c.Pages = pages
+	c.Delete = deletes
+	return c
+}
@@ -0,0 +1,204 @@
+package ingestion
+
+import (
+	"context"
+	"logging"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// unitEmbedder embeds every text as the same vector
+type unitEmbedder struct{}
+
+func (unitEmbedder) EmbedDocuments(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i := range vectors {
+		vectors[i] = []float32{1, 0}
+	}
+	return vectors, nil
+}
+
+func (unitEmbedder) EmbedQuery(context.Context, string) ([]float32, error) {
+	return []float32{1, 0}, nil
+}
+
+// refCrawler returns the README of a repository as GitCrawler reads it at ref
+type refCrawler struct{ ref string }
+
+func (c refCrawler) Crawl(_ context.Context, repoURL string, _ Options) (CrawlResult, error) {
+	return CrawlResult{BaseURL: repoURL, Documents: []schema.Document{{
+		PageContent: "Install version " + c.ref,
+		Metadata:    map[string]any{"source": GitSource(repoURL, c.ref, "README.md"), "repo": repoURL},
+	}}}, nil
+}
+
+func TestPipelineKeepsGitRefsApart(t *testing.T) {
+	vectors := vectorstore.NewMemory(unitEmbedder{})
+	manifest := NewManifest()
+	ingest := func(ref string) Result {
+		t.Helper()
+		source := Source{GitURL: "https://github.com/example/docs.git", GitRef: ref}
+		pipeline := &Pipeline{
+			Crawler:     refCrawler{ref: ref},
+			Splitter:    pageSplitter{},
+			Store:       NewStore(vectors, 10, 1, logging.New()),
+			Logger:      logging.New(),
+			Options:     Options{Manifest: manifest},
+			ManifestKey: source.String(),
+		}
+		result, err := pipeline.Run(context.Background(), source.location())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	ingest("v1")
+	if result := ingest("v2"); result.ChunksAdded != 1 || result.ChunksRemoved != 0 {
+		t.Errorf("ingesting a second ref: %+v, want 1 chunk added and none removed", result)
+	}
+	if result := ingest("v1"); result.ChunksUnchanged != 1 || result.ChunksRemoved != 0 {
+		t.Errorf("ingesting the first ref again: %+v, want its chunk unchanged", result)
+	}
+
+	docs, err := vectors.SimilaritySearch(context.Background(), "install", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	for _, doc := range docs {
+		sources = append(sources, doc.Metadata["source"].(string))
+	}
+	slices.Sort(sources)
+	want := []string{"https://github.com/example/docs.git@v1:README.md", "https://github.com/example/docs.git@v2:README.md"}
+	if !slices.Equal(sources, want) {
+		t.Errorf("stored %v, want both refs", sources)
+	}
+}
+
+// pageChunks returns chunks with IDs for page, one per content
+func pageChunks(page string, tags []any, contents ...string) []schema.Document {
+	chunks := make([]schema.Document, len(contents))
+	for i, content := range contents {
+		metadata := map[string]any{"source": page}
+		if tags != nil {
+			metadata[TagsKey] = tags
+		}
+		chunks[i] = schema.Document{PageContent: content, Metadata: metadata}
+	}
+	return assignChunkIDs(chunks)
+}
+
+// chunkIDs returns the IDs of chunks in order
+func chunkIDs(chunks []schema.Document) []string {
+	ids := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		ids[i] = chunk.Metadata[vectorstore.ChunkIDKey].(string)
+	}
+	return ids
+}
+
+func TestDiffChunks(t *testing.T) {
+	intro := pageChunks("intro", nil, "Welcome.", "Install it.")
+	editedIntro := pageChunks("intro", nil, "Welcome.", "Install it with go get.")
+	retaggedIntro := pageChunks("intro", []any{"v2"}, "Welcome.", "Install it.")
+	faq := pageChunks("faq", nil, "Why?", "Because.")
+	previous := map[string][]string{"intro": chunkIDs(intro), "faq": chunkIDs(faq)}
+
+	tests := []struct {
+		name                               string
+		chunks                             []schema.Document
+		add, delete                        []string
+		added, updated, unchanged, removed int
+	}{
+		{
+			name:      "unchanged pages",
+			chunks:    slices.Concat(intro, faq),
+			unchanged: 4,
+		},
+		{
+			name:      "edited page",
+			chunks:    slices.Concat(editedIntro, faq),
+			add:       chunkIDs(editedIntro[1:]),
+			delete:    chunkIDs(intro[1:]),
+			updated:   1,
+			unchanged: 3,
+		},
+		{
+			name:      "vanished page",
+			chunks:    intro,
+			delete:    chunkIDs(faq),
+			unchanged: 2,
+			removed:   2,
+		},
+		{
+			name:      "page with new IDs",
+			chunks:    slices.Concat(retaggedIntro, faq),
+			add:       chunkIDs(retaggedIntro),
+			delete:    chunkIDs(intro),
+			updated:   2,
+			unchanged: 2,
+		},
+		{
+			name:      "new page and a shorter page",
+			chunks:    slices.Concat(intro, pageChunks("faq", nil, "Why?"), pageChunks("guide", nil, "Step one.")),
+			add:       chunkIDs(pageChunks("guide", nil, "Step one.")),
+			delete:    chunkIDs(faq[1:]),
+			added:     1,
+			unchanged: 3,
+			removed:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := diffChunks(tt.chunks, previous)
+			if got := chunkIDs(changes.Add); !slices.Equal(got, tt.add) {
+				t.Errorf("add = %v, want %v", got, tt.add)
+			}
+			if !slices.Equal(changes.Delete, tt.delete) {
+				t.Errorf("delete = %v, want %v", changes.Delete, tt.delete)
+			}
+			if changes.Added != tt.added || changes.Updated != tt.updated || changes.Unchanged != tt.unchanged || changes.Removed != tt.removed {
+				t.Errorf("added %d, updated %d, unchanged %d, removed %d; want %d, %d, %d, %d",
+					changes.Added, changes.Updated, changes.Unchanged, changes.Removed, tt.added, tt.updated, tt.unchanged, tt.removed)
+			}
+			if want := diffChunks(tt.chunks, nil).Pages; !maps.EqualFunc(changes.Pages, want, slices.Equal) {
+				t.Errorf("pages = %v, want the IDs of the new chunks %v", changes.Pages, want)
+			}
+		})
+	}
+}
+
+func TestChangeSetWithoutFailed(t *testing.T) {
+	intro := pageChunks("intro", nil, "Welcome.", "Install it.")
+	editedIntro := pageChunks("intro", nil, "Welcome.", "Install it with go get.")
+	faq := pageChunks("faq", nil, "Why?")
+	editedFAQ := pageChunks("faq", nil, "Why not?")
+	previous := map[string][]string{"intro": chunkIDs(intro), "faq": chunkIDs(faq)}
+
+	changes := diffChunks(slices.Concat(editedIntro, editedFAQ), previous)
+	failed := map[string]bool{chunkIDs(editedIntro)[1]: true}
+	changes = changes.withoutFailed(failed, previous)
+
+	// The stale chunk of the page whose new chunk failed stays stored and
+	// recorded until the next ingest replaces it
+	if want := chunkIDs(faq); !slices.Equal(changes.Delete, want) {
+		t.Errorf("delete = %v, want only the stale FAQ chunk %v", changes.Delete, want)
+	}
+	if want := []string{chunkIDs(intro)[0], chunkIDs(intro)[1]}; !slices.Equal(changes.Pages["intro"], want) {
+		t.Errorf("pages[intro] = %v, want the stored chunk and the stale one %v", changes.Pages["intro"], want)
+	}
+	if want := chunkIDs(editedFAQ); !slices.Equal(changes.Pages["faq"], want) {
+		t.Errorf("pages[faq] = %v, want %v", changes.Pages["faq"], want)
+	}
+
+	// The next ingest stores the failed chunk and removes the stale one
+	next := diffChunks(slices.Concat(editedIntro, editedFAQ), changes.Pages)
+	if !slices.Equal(chunkIDs(next.Add), chunkIDs(editedIntro[1:])) || !slices.Equal(next.Delete, chunkIDs(intro[1:])) {
+		t.Errorf("next ingest adds %v and deletes %v, want the failed chunk replacing the stale one", chunkIDs(next.Add), next.Delete)
+	}
+}
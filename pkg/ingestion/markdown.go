@@ -0,0 +1,304 @@
+package ingestion
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+// Splitters accepted in Options.Splitter
+const (
+	SplitterMarkdown  = "markdown"
+	SplitterRecursive = "recursive"
+)
+
+// headingPattern matches an ATX heading with an optional {#id} attribute
+var headingPattern = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)(?:[ \t]+\{#([^}\s]+)\})?[ \t#]*$`)
+
+// setextPattern matches the underline that turns the paragraph above it into
+// a level 1 ("=") or level 2 ("-") setext heading
+var setextPattern = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+
+// headingAnchorPattern matches the {#id} attribute ending a setext heading
+var headingAnchorPattern = regexp.MustCompile(`[ \t]+\{#([^}\s]+)\}$`)
+
+// MarkdownSplitter splits pages on their headings, ATX ("## Title") or setext
+// (a line underlined with "=" or "-"), so every chunk belongs to a single section. Sections larger than ChunkSize are split between paragraphs
+// and code blocks; fenced code blocks are never cut, even when they alone
+// exceed ChunkSize, and only oversized prose falls back to a recursive
+// character split with ChunkOverlap.
+//
+// HTML pages are converted with ExtractHTML first. Every chunk keeps the page
+// metadata and adds doc_index, chunk_index, heading_path (the titles of the
+// enclosing headings joined by " > "), section_title and anchor, the fragment
+// that links to the section. Continuation chunks of a section repeat its
+// heading line so they stay self-describing.
+type MarkdownSplitter struct {
+	ChunkSize    int
+	ChunkOverlap int
+}
+
+// NewMarkdownSplitter creates a MarkdownSplitter
+func NewMarkdownSplitter(chunkSize, chunkOverlap int) *MarkdownSplitter {
+	return &MarkdownSplitter{ChunkSize: chunkSize, ChunkOverlap: chunkOverlap}
+}
+
+// mdSection is the text below one heading, up to the next heading
+type mdSection struct {
+	headingLine string   // Heading as written, empty for text before the first heading
+	path        []string // Titles of the enclosing headings, outermost first
+	anchor      string
+	blocks      []string // Paragraphs and fenced code blocks
+}
+
+// Split splits each document into section-aligned chunks
+func (s *MarkdownSplitter) Split(docs []schema.Document) ([]schema.Document, error) {
+	fallback := textsplitter.NewRecursiveCharacter(
+		textsplitter.WithChunkSize(s.ChunkSize),
+		textsplitter.WithChunkOverlap(s.ChunkOverlap),
+	)
+
+	documents := make([]schema.Document, 0, len(docs))
+	for docIdx, doc := range docs {
+		content := doc.PageContent
+		if looksLikeHTML(content) {
+			page, err := ExtractHTML(strings.NewReader(content))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse HTML of document %d: %w", docIdx, err)
+			}
+			content = page.Text
+		}
+
+		chunkIdx := 0
+		for _, section := range parseMarkdownSections(content) {
+			chunks, err := s.packSection(section, fallback)
+			if err != nil {
+				return nil, fmt.Errorf("failed to split document %d: %w", docIdx, err)
+			}
+			for _, chunk := range chunks {
+				meta := map[string]any{}
+				for k, v := range doc.Metadata {
+					meta[k] = v
+				}
+				meta["doc_index"] = docIdx
+				meta["chunk_index"] = chunkIdx
+				meta["heading_path"] = strings.Join(section.path, " > ")
+				meta["section_title"] = ""
+				if len(section.path) > 0 {
+					meta["section_title"] = section.path[len(section.path)-1]
+				}
+				meta["anchor"] = section.anchor
+				chunkIdx++
+
+				documents = append(documents, schema.Document{
+					PageContent: chunk,
+					Metadata:    meta,
+				})
+			}
+		}
+	}
+	return documents, nil
+}
+
+// packSection groups a section's blocks into chunks of at most ChunkSize
+// characters where possible. Sections with a heading but no text yield none.
+func (s *MarkdownSplitter) packSection(section mdSection, fallback textsplitter.TextSplitter) ([]string, error) {
+	prefix := ""
+	if section.headingLine != "" {
+		prefix = section.headingLine + "\n\n"
+	}
+
+	var chunks []string
+	var body []string
+	size := len(prefix)
+	flush := func() {
+		if len(body) > 0 {
+			chunks = append(chunks, prefix+strings.Join(body, "\n\n"))
+		}
+		body, size = nil, len(prefix)
+	}
+
+	for _, block := range section.blocks {
+		if len(body) > 0 && size+len(block)+2 > s.ChunkSize {
+			flush()
+		}
+		if size+len(block) > s.ChunkSize && !isFence(block) {
+			// Oversized prose is split on its own; code blocks are kept whole
+			parts, err := fallback.SplitText(block)
+			if err != nil {
+				return nil, err
+			}
+			for _, part := range parts {
+				body = append(body, part)
+				flush()
+			}
+			continue
+		}
+		body = append(body, block)
+		size += len(block) + 2
+	}
+	flush()
+	return chunks, nil
+}
+
+// parseMarkdownSections splits markdown into sections at every heading
+// outside fenced code blocks
+func parseMarkdownSections(text string) []mdSection {
+	var sections []mdSection
+	var titles [6]string
+	anchors := map[string]int{}
+
+	current := mdSection{}
+	var paragraph []string
+	var fence []string
+	fenceMarker := ""
+
+	endParagraph := func() {
+		if len(paragraph) > 0 {
+			current.blocks = append(current.blocks, strings.Join(paragraph, "\n"))
+			paragraph = nil
+		}
+	}
+	startSection := func(level int, title, anchor string) {
+		if current.headingLine != "" || len(current.blocks) > 0 {
+			sections = append(sections, current)
+		}
+
+		titles[level-1] = title
+		for i := level; i < len(titles); i++ {
+			titles[i] = ""
+		}
+		var path []string
+		for _, t := range titles[:level] {
+			if t != "" {
+				path = append(path, t)
+			}
+		}
+
+		if anchor == "" {
+			anchor = slugify(title)
+			if n := anchors[anchor]; n > 0 {
+				anchors[anchor] = n + 1
+				anchor = fmt.Sprintf("%s-%d", anchor, n)
+			} else {
+				anchors[anchor] = 1
+			}
+		}
+
+		current = mdSection{
+			headingLine: strings.Repeat("#", level) + " " + title,
+			path:        path,
+			anchor:      anchor,
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if fenceMarker != "" {
+			fence = append(fence, line)
+			if closesFence(line, fenceMarker) {
+				current.blocks = append(current.blocks, strings.Join(fence, "\n"))
+				fence, fenceMarker = nil, ""
+			}
+			continue
+		}
+		if marker := openingFence(line); marker != "" {
+			endParagraph()
+			fence, fenceMarker = []string{line}, marker
+			continue
+		}
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			endParagraph()
+			startSection(len(m[1]), strings.TrimSpace(m[2]), m[3])
+			continue
+		}
+		if m := setextPattern.FindStringSubmatch(line); m != nil && len(paragraph) > 0 {
+			// The paragraph above the underline is the heading's title
+			title := strings.TrimSpace(strings.Join(paragraph, " "))
+			anchor := ""
+			if a := headingAnchorPattern.FindStringSubmatch(title); a != nil {
+				title, anchor = strings.TrimSuffix(title, a[0]), a[1]
+			}
+			paragraph = nil
+			level := 1
+			if m[1][0] == '-' {
+				level = 2
+			}
+			startSection(level, title, anchor)
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			endParagraph()
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+
+	if fenceMarker != "" {
+		// Unterminated fence: keep it as one block rather than lose it
+		current.blocks = append(current.blocks, strings.Join(fence, "\n"))
+	}
+	endParagraph()
+	if current.headingLine != "" || len(current.blocks) > 0 {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// openingFence returns the fence marker that line opens, if any
+func openingFence(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return ""
+	}
+	for _, c := range []byte{'`', '~'} {
+		n := 0
+		for n < len(trimmed) && trimmed[n] == c {
+			n++
+		}
+		if n >= 3 {
+			if c == '`' && strings.Contains(trimmed[n:], "`") {
+				return "" // Inline code, not a fence
+			}
+			return trimmed[:n]
+		}
+	}
+	return ""
+}
+
+// closesFence reports whether line closes a fence opened with marker
+func closesFence(line, marker string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, marker) && strings.Trim(trimmed, marker[:1]) == ""
+}
+
+func isFence(block string) bool {
+	return openingFence(strings.SplitN(block, "\n", 2)[0]) != ""
+}
+
+// slugify turns a heading into a GitHub-style anchor
+func slugify(title string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// looksLikeHTML reports whether content is an HTML document rather than markdown
+func looksLikeHTML(content string) bool {
+	head := strings.ToLower(strings.TrimSpace(content))
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	return strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html") ||
+		strings.HasPrefix(head, "<head") || strings.HasPrefix(head, "<body")
+}
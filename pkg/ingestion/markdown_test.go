@@ -0,0 +1,106 @@
+package ingestion
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// wantChunk describes one chunk produced by MarkdownSplitter
+type wantChunk struct {
+	headingPath string
+	anchor      string
+	contains    string // Text the chunk must contain
+}
+
+func TestMarkdownSplitter(t *testing.T) {
+	longFence := "```go\n" + strings.Repeat("fmt.Println(\"a line of code\")\n", 10) + "```"
+
+	tests := []struct {
+		name      string
+		content   string
+		chunkSize int
+		want      []wantChunk
+	}{
+		{
+			name:      "fence longer than the chunk size",
+			content:   "# Example\n\nSome prose.\n\n" + longFence + "\n\nAfter.",
+			chunkSize: 60,
+			want: []wantChunk{
+				{"Example", "example", "Some prose."},
+				{"Example", "example", longFence},
+				{"Example", "example", "After."},
+			},
+		},
+		{
+			name:      "fence with heading lines",
+			content:   "# Script\n\n```sh\n# install\nmake\n## not a heading\n```\n\nDone.",
+			chunkSize: 1000,
+			want: []wantChunk{
+				{"Script", "script", "```sh\n# install\nmake\n## not a heading\n```\n\nDone."},
+			},
+		},
+		{
+			name:      "nested headings",
+			content:   "Preface.\n\n# Guide\n\nIntro.\n\n## Install\n\nSteps.\n\n### Linux\n\nApt.\n\n## Usage {#use}\n\nRun.\n\n## Install\n\nAgain.",
+			chunkSize: 1000,
+			want: []wantChunk{
+				{"", "", "Preface."},
+				{"Guide", "guide", "# Guide\n\nIntro."},
+				{"Guide > Install", "install", "## Install\n\nSteps."},
+				{"Guide > Install > Linux", "linux", "### Linux\n\nApt."},
+				{"Guide > Usage", "use", "## Usage\n\nRun."},
+				{"Guide > Install", "install-1", "Again."},
+			},
+		},
+		{
+			name:      "setext headings",
+			content:   "Guide\n=====\n\nIntro.\n\nInstall {#setup}\n-------\n\nSteps.",
+			chunkSize: 1000,
+			want: []wantChunk{
+				{"Guide", "guide", "# Guide\n\nIntro."},
+				{"Guide > Install", "setup", "## Install\n\nSteps."},
+			},
+		},
+		{
+			name:      "html",
+			content:   `<html><head><title>Docs</title></head><body><h1>Docs</h1><p>Welcome.</p><h2 id="quick-start">Quick start</h2><pre><code>go get example.com/x</code></pre></body></html>`,
+			chunkSize: 1000,
+			want: []wantChunk{
+				{"Docs", "docs", "Welcome."},
+				{"Docs > Quick start", "quick-start", "```\ngo get example.com/x\n```"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splitter := NewMarkdownSplitter(tt.chunkSize, 0)
+			chunks, err := splitter.Split([]schema.Document{{PageContent: tt.content, Metadata: map[string]any{"source": "https://example.com/page"}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chunks) != len(tt.want) {
+				for _, chunk := range chunks {
+					t.Logf("%q %v", chunk.PageContent, chunk.Metadata)
+				}
+				t.Fatalf("got %d chunks, want %d", len(chunks), len(tt.want))
+			}
+			for i, want := range tt.want {
+				meta := chunks[i].Metadata
+				path := strings.Split(want.headingPath, " > ")
+				title := path[len(path)-1]
+				if meta["heading_path"] != want.headingPath || meta["anchor"] != want.anchor || meta["section_title"] != title {
+					t.Errorf("chunk %d: heading_path %q, anchor %q, section_title %q; want %q, %q, %q",
+						i, meta["heading_path"], meta["anchor"], meta["section_title"], want.headingPath, want.anchor, title)
+				}
+				if !strings.Contains(chunks[i].PageContent, want.contains) {
+					t.Errorf("chunk %d = %q, want it to contain %q", i, chunks[i].PageContent, want.contains)
+				}
+				if meta["source"] != "https://example.com/page" || meta["chunk_index"] != i {
+					t.Errorf("chunk %d lost the page metadata: %v", i, meta)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package ingestion
+
+import (
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Chunk metadata set by the pipeline so queries can filter on it
+const (
+	HostKey        = "host"         // Lowercase host of web pages; unset for files
+	URLPrefixesKey = "url_prefixes" // The page URL or path and every parent directory of it
+	TagsKey        = "tags"         // Options.Tags of the ingest that stored the chunk
+	IngestedAtKey  = "ingested_at"  // Unix time in seconds the chunk was first stored
+)
+
+// stampChunks sets the filterable metadata on every chunk. Lists are stored
+// as []any, the list type vector store metadata accepts.
+func stampChunks(chunks []schema.Document, tags []string, ingestedAt time.Time) {
+	tags = slices.Compact(slices.Sorted(slices.Values(tags)))
+	for i := range chunks {
+		metadata := chunks[i].Metadata
+		if metadata == nil {
+			metadata = map[string]any{}
+			chunks[i].Metadata = metadata
+		}
+		page, _ := metadata["source"].(string)
+		if host := pageHost(page); host != "" {
+			metadata[HostKey] = host
+		}
+		metadata[URLPrefixesKey] = toAnySlice(URLPrefixes(page))
+		if len(tags) > 0 {
+			metadata[TagsKey] = toAnySlice(tags)
+		}
+		metadata[IngestedAtKey] = ingestedAt.Unix()
+	}
+}
+
+// URLPrefixes returns page, without query and fragment, followed by every
+// parent directory of it, each ending in a slash. Matching a prefix filter
+// against this list works with any vector store that supports "$in".
+//
+//	https://example.com/docs/guide/install -> https://example.com/docs/guide/install,
+//	https://example.com/docs/guide/, https://example.com/docs/, https://example.com/
+func URLPrefixes(page string) []string {
+	if page == "" {
+		return nil
+	}
+
+	root, path := "", filepath.ToSlash(page)
+	if u, err := url.Parse(page); err == nil && u.Scheme != "" && u.Host != "" {
+		root = strings.ToLower(u.Scheme + "://" + u.Host)
+		path = u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	prefixes := []string{root + path}
+	for {
+		i := strings.LastIndex(strings.TrimSuffix(path, "/"), "/")
+		if i < 0 {
+			break
+		}
+		path = path[:i+1]
+		prefixes = append(prefixes, root+path)
+	}
+	return slices.Compact(prefixes)
+}
+
+// pageHost returns the lowercase host of a web page, or "" for file paths
+func pageHost(page string) string {
+	u, err := url.Parse(page)
+	if err != nil || u.Scheme == "" {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func toAnySlice(values []string) []any {
+	out := make([]any, 0, len(values))
+	for _, v := range values {
+		out = append(out, v)
+	}
+	return out
+}
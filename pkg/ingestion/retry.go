@@ -0,0 +1,130 @@
+package ingestion
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultMaxRetries is how many times a failing batch is retried
+const defaultMaxRetries = 5
+
+// defaultBatchTimeout bounds one attempt to store a batch, so a provider call
+// that hangs is retried instead of blocking the ingestion forever
+const defaultBatchTimeout = 2 * time.Minute
+
+// Delays between the attempts to store a batch. The n-th retry waits a
+// random duration up to defaultRetryBaseDelay*2^(n-1), capped at
+// defaultRetryMaxDelay, unless the provider asked for a longer wait.
+const (
+	defaultRetryBaseDelay = time.Second
+	defaultRetryMaxDelay  = time.Minute
+)
+
+// rateLimitPattern matches the rate limit errors of the embedding and vector
+// store providers, whose clients only report the status in the message
+var rateLimitPattern = regexp.MustCompile(`(?i)\b429\b|too many requests|rate.?limit|resource.?exhausted|quota`)
+
+// isRateLimited reports whether err says the provider throttled the request
+func isRateLimited(err error) bool {
+	return err != nil && rateLimitPattern.MatchString(err.Error())
+}
+
+// permanentPattern matches the authentication errors of the providers, which
+// no retry fixes
+var permanentPattern = regexp.MustCompile(`(?i)\b40[13]\b|unauthori[sz]ed|forbidden|invalid.?api.?key|incorrect api key|permission.?denied`)
+
+// isPermanent reports whether err says the request can never succeed as is
+func isPermanent(err error) bool {
+	return err != nil && !isRateLimited(err) && permanentPattern.MatchString(err.Error())
+}
+
+// backoff returns the delay before retry number attempt (from 1): full
+// jitter over an exponentially growing window
+func backoff(attempt int, base, limit time.Duration) time.Duration {
+	window := limit
+	if attempt <= 30 {
+		window = min(base<<(attempt-1), limit)
+	}
+	if window <= 0 {
+		return 0
+	}
+	return rand.N(window) + 1
+}
+
+// rateLimitHint collects the rate limit responses received by the requests
+// made for one attempt to store a batch
+type rateLimitHint struct {
+	mu         sync.Mutex
+	limited    bool
+	retryAfter time.Duration
+}
+
+type rateLimitHintKey struct{}
+
+// withRateLimitHint returns a context whose HTTP requests report rate limit
+// responses to hint, when they are sent through a RateLimitTransport
+func withRateLimitHint(ctx context.Context, hint *rateLimitHint) context.Context {
+	return context.WithValue(ctx, rateLimitHintKey{}, hint)
+}
+
+func (h *rateLimitHint) record(retryAfter time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.limited = true
+	h.retryAfter = max(h.retryAfter, retryAfter)
+}
+
+// wait returns whether a rate limit response was received and the longest
+// Retry-After it asked for
+func (h *rateLimitHint) wait() (bool, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.limited, h.retryAfter
+}
+
+// RateLimitTransport is an http.RoundTripper that reports 429 and 503
+// responses, with their Retry-After delay, to the Store storing the batch the
+// request was made for. Provider clients return these responses as plain
+// errors, so an embedder whose HTTP client uses this transport lets the Store
+// wait as long as the provider asks before retrying. Requests made outside a
+// Store are passed through unchanged.
+type RateLimitTransport struct {
+	Base http.RoundTripper // Nil uses http.DefaultTransport
+}
+
+func (t RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if hint, ok := req.Context().Value(rateLimitHintKey{}).(*rateLimitHint); ok {
+			hint.record(parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+		}
+	}
+	return resp, nil
+}
+
+// parseRetryAfter reads a Retry-After header, either a number of seconds or
+// an HTTP date. Missing or invalid values return 0.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
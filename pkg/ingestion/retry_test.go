@@ -0,0 +1,115 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"7", 7 * time.Second},
+		{"0", 0},
+		{"-3", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, limit := 100*time.Millisecond, 2*time.Second
+	for attempt := 1; attempt <= 40; attempt++ {
+		window := limit
+		if attempt <= 5 {
+			window = base << (attempt - 1)
+		}
+		for range 200 {
+			if d := backoff(attempt, base, limit); d <= 0 || d > window {
+				t.Fatalf("backoff(%d) = %v, want within (0, %v]", attempt, d, window)
+			}
+		}
+	}
+	if d := backoff(3, 0, 0); d != 0 {
+		t.Errorf("backoff without delays = %v, want 0", d)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	tests := []struct {
+		err                    error
+		rateLimited, permanent bool
+	}{
+		{errors.New("API returned unexpected status code: 429: Too Many Requests"), true, false},
+		{errors.New("googleapi: Error 429: Resource has been exhausted"), true, false},
+		{errors.New("Error 403: Quota exceeded for quota metric"), true, false},
+		{errors.New("API returned unexpected status code: 401: Incorrect API key provided"), false, true},
+		{errors.New("rpc error: code = PermissionDenied desc = forbidden"), false, true},
+		{errors.New("connection reset by peer"), false, false},
+		{errors.New("batch of 4010 vectors"), false, false},
+		{nil, false, false},
+	}
+	for _, tt := range tests {
+		if got := isRateLimited(tt.err); got != tt.rateLimited {
+			t.Errorf("isRateLimited(%v) = %v, want %v", tt.err, got, tt.rateLimited)
+		}
+		if got := isPermanent(tt.err); got != tt.permanent {
+			t.Errorf("isPermanent(%v) = %v, want %v", tt.err, got, tt.permanent)
+		}
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	status := http.StatusTooManyRequests
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(status)
+	}))
+	defer provider.Close()
+	client := &http.Client{Transport: RateLimitTransport{}}
+
+	request := func(ctx context.Context) {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Fatalf("status = %d, want the response passed through", resp.StatusCode)
+		}
+	}
+
+	hint := &rateLimitHint{}
+	request(withRateLimitHint(context.Background(), hint))
+	if limited, retryAfter := hint.wait(); !limited || retryAfter != 7*time.Second {
+		t.Errorf("hint after a 429 = %v, %v, want true, 7s", limited, retryAfter)
+	}
+
+	// Requests made outside a Store are passed through
+	request(context.Background())
+
+	status = http.StatusBadRequest
+	hint = &rateLimitHint{}
+	request(withRateLimitHint(context.Background(), hint))
+	if limited, _ := hint.wait(); limited {
+		t.Error("a 400 was reported as rate limited")
+	}
+}
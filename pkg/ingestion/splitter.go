@@ -0,0 +1,53 @@
+package ingestion
+
+import (
+	"fmt"
+
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+// Splitter turns crawled pages into the chunks that get embedded
+type Splitter interface {
+	Split(docs []schema.Document) ([]schema.Document, error)
+}
+
+// TextSplitter splits every page with a langchaingo text splitter and copies
+// the page metadata onto each chunk, adding doc_index and chunk_index.
+type TextSplitter struct {
+	splitter textsplitter.TextSplitter
+}
+
+// NewTextSplitter creates a TextSplitter backed by a recursive character splitter
+func NewTextSplitter(chunkSize, chunkOverlap int) *TextSplitter {
+	return &TextSplitter{splitter: textsplitter.NewRecursiveCharacter(
+		textsplitter.WithChunkSize(chunkSize),
+		textsplitter.WithChunkOverlap(chunkOverlap),
+	)}
+}
+
+// Split splits each document and preserves its metadata on every chunk
+func (s *TextSplitter) Split(docs []schema.Document) ([]schema.Document, error) {
+	documents := make([]schema.Document, 0, len(docs))
+	for docIdx, doc := range docs {
+		chunks, err := s.splitter.SplitText(doc.PageContent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split document %d: %w", docIdx, err)
+		}
+		for chunkIdx, chunk := range chunks {
+			// copy metadata and add provenance fields
+			meta := map[string]any{}
+			for k, v := range doc.Metadata {
+				meta[k] = v
+			}
+			meta["doc_index"] = docIdx
+			meta["chunk_index"] = chunkIdx
+
+			documents = append(documents, schema.Document{
+				PageContent: chunk,
+				Metadata:    meta,
+			})
+		}
+	}
+	return documents, nil
+}
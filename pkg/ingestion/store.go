@@ -0,0 +1,286 @@
+package ingestion
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"logging"
+	"slices"
+	"time"
+
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// batchJob is one slice of documents handed to a storage worker
+type batchJob struct {
+	batchNum  int
+	documents []schema.Document
+}
+
+// batchResult is what a worker reports back for a batchJob
+type batchResult struct {
+	batchNum int
+	ids      []string
+	attempts int
+	err      error
+	skipped  bool // Not attempted because the store was stopped
+}
+
+// FailedBatch is a batch that could not be stored after every retry. Its
+// chunks are left out of the manifest, so the next ingest of the source
+// stores them again.
+type FailedBatch struct {
+	Batch    int      `json:"batch"`
+	Chunks   int      `json:"chunks"`
+	Attempts int      `json:"attempts"`
+	Error    string   `json:"error"`
+	Sources  []string `json:"sources"` // Pages the batch's chunks come from
+}
+
+// Store embeds and stores chunks in a vector store, in batches spread over a
+// pool of workers. The number of batches stored at once adapts to the
+// provider: it starts at workers, halves whenever a request is rate limited
+// and grows back up to MaxWorkers while requests succeed. A failing or timed
+// out attempt is retried with exponential backoff and jitter, waiting at least
+// as long as a Retry-After reported through RateLimitTransport. Authentication
+// errors are not retried.
+type Store struct {
+	store     vectorstores.VectorStore
+	batchSize int
+	workers   int
+	logger    logging.Logger
+
+	MaxWorkers   int           // Upper bound of the concurrency; zero uses twice workers
+	MaxRetries   int           // Retries of a failing batch; zero uses 5
+	BatchTimeout time.Duration // Deadline of one attempt to store a batch; zero uses 2m
+
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+}
+
+// NewStore creates a Store stage writing to store
+func NewStore(store vectorstores.VectorStore, batchSize, workers int, logger logging.Logger) *Store {
+	return &Store{
+		store:     store,
+		batchSize: batchSize,
+		workers:   workers,
+		logger:    logger,
+
+		retryBaseDelay: defaultRetryBaseDelay,
+		retryMaxDelay:  defaultRetryMaxDelay,
+	}
+}
+
+// DeleteIDs removes stored chunks by ID. The vector store must implement
+// vectorstore.Store.
+func (s *Store) DeleteIDs(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	store, ok := s.store.(vectorstore.Store)
+	if !ok {
+		return errors.New("vector store does not support deleting documents")
+	}
+	return store.DeleteIDs(ctx, ids)
+}
+
+// Add stores documents and returns how many batches were written and the
+// batches that failed after every retry. Batches whose number is in done were
+// written by an earlier run and are only counted. A failed batch does not stop
+// the others.
+//
+// An error is returned when ctx is cancelled, in which case the batches being
+// stored are finished and the others skipped, or when every batch attempted
+// failed, which usually means the provider is misconfigured.
+func (s *Store) Add(ctx context.Context, documents []schema.Document, progress Progress, done map[int]bool) (int, []FailedBatch, error) {
+	logger := s.logger
+	batchSize := s.batchSize
+	maxWorkers := cmp.Or(s.MaxWorkers, 2*s.workers)
+	totalBatches := (len(documents) + batchSize - 1) / batchSize
+	logger.Info(ctx, "Processing documents in batches with worker pool", map[string]any{
+		"batch_size":     batchSize,
+		"total_batches":  totalBatches,
+		"workers":        s.workers,
+		"max_workers":    maxWorkers,
+		"already_stored": len(done),
+	})
+
+	limiter := newConcurrencyLimiter(s.workers, maxWorkers)
+
+	// Channel for jobs and results
+	jobs := make(chan batchJob, totalBatches)
+	results := make(chan batchResult, totalBatches)
+
+	// Create worker pool; the limiter decides how many of them store at once
+	for w := 1; w <= maxWorkers; w++ {
+		go func(workerID int) {
+			for job := range jobs {
+				if done[job.batchNum] {
+					progress.BatchStored(job.batchNum, len(job.documents))
+					results <- batchResult{batchNum: job.batchNum, ids: make([]string, len(job.documents))}
+					continue
+				}
+				if ctx.Err() != nil {
+					results <- batchResult{batchNum: job.batchNum, skipped: true}
+					continue
+				}
+
+				ids, attempts, err := s.storeBatch(ctx, limiter, workerID, totalBatches, job)
+				result := batchResult{batchNum: job.batchNum, ids: ids, attempts: attempts, err: err}
+				switch {
+				case err == nil:
+					progress.BatchStored(job.batchNum, len(ids))
+					logger.Info(ctx, "Worker successfully stored batch", map[string]any{
+						"worker":     workerID,
+						"batch":      job.batchNum,
+						"batch_size": len(ids),
+						"attempts":   attempts,
+					})
+				case ctx.Err() != nil:
+					result.skipped = true
+				default:
+					progress.BatchFailed(job.batchNum, len(job.documents), err)
+					logger.Error(ctx, "Worker failed to store batch", map[string]any{
+						"worker":   workerID,
+						"batch":    job.batchNum,
+						"attempts": attempts,
+						"error":    err.Error(),
+					})
+				}
+				results <- result
+			}
+		}(w)
+	}
+
+	// Send jobs to workers
+	go func() {
+		for i := 0; i < len(documents); i += batchSize {
+			end := min(i+batchSize, len(documents))
+			jobs <- batchJob{
+				batchNum:  (i / batchSize) + 1,
+				documents: documents[i:end],
+			}
+		}
+		close(jobs)
+	}()
+
+	// Collect results
+	stored := 0
+	storedNow := 0 // Batches stored by this run rather than an earlier one
+	storedDocs := 0
+	var failed []FailedBatch
+	var firstErr error
+	for i := 0; i < totalBatches; i++ {
+		result := <-results
+		switch {
+		case result.skipped:
+		case result.err != nil:
+			start := (result.batchNum - 1) * batchSize
+			batch := documents[start:min(start+batchSize, len(documents))]
+			failed = append(failed, FailedBatch{
+				Batch:    result.batchNum,
+				Chunks:   len(batch),
+				Attempts: result.attempts,
+				Error:    result.err.Error(),
+				Sources:  batchSources(batch),
+			})
+			if firstErr == nil {
+				firstErr = result.err
+			}
+		default:
+			stored++
+			storedDocs += len(result.ids)
+			if !done[result.batchNum] {
+				storedNow++
+			}
+		}
+	}
+	slices.SortFunc(failed, func(a, b FailedBatch) int { return a.Batch - b.Batch })
+
+	if ctx.Err() != nil {
+		err := context.Cause(ctx)
+		logger.Error(ctx, "Stopped storing batches", map[string]any{"error": err.Error(), "batches_stored": stored, "batches_failed": len(failed)})
+		return stored, failed, err
+	}
+	if len(failed) > 0 && storedNow == 0 {
+		logger.Error(ctx, "Every batch failed", map[string]any{"batches_stored": stored, "batches_failed": len(failed)})
+		return stored, failed, fmt.Errorf("all %d batches attempted failed: %w", len(failed), firstErr)
+	}
+	if len(failed) > 0 {
+		logger.Error(ctx, "Some batches could not be stored", map[string]any{"batches_stored": stored, "batches_failed": len(failed)})
+		return stored, failed, nil
+	}
+
+	logger.Info(ctx, "Successfully stored all documents concurrently", map[string]any{"total_count": storedDocs})
+	return stored, nil, nil
+}
+
+// storeBatch stores one batch, retrying failures with backoff. It returns the
+// number of attempts made. A batch being stored when ctx is cancelled is
+// finished, so the batches reported as stored are exactly those written, but
+// it is not retried. Every attempt is bounded by the batch timeout.
+func (s *Store) storeBatch(ctx context.Context, limiter *concurrencyLimiter, workerID, totalBatches int, job batchJob) ([]string, int, error) {
+	logger := s.logger
+	maxRetries := cmp.Or(s.MaxRetries, defaultMaxRetries)
+	timeout := cmp.Or(s.BatchTimeout, defaultBatchTimeout)
+	for attempt := 1; ; attempt++ {
+		if err := limiter.acquire(ctx); err != nil {
+			return nil, attempt - 1, err
+		}
+		logger.Info(ctx, "Worker processing batch", map[string]any{
+			"worker":        workerID,
+			"batch":         job.batchNum,
+			"total_batches": totalBatches,
+			"batch_size":    len(job.documents),
+			"attempt":       attempt,
+		})
+
+		hint := &rateLimitHint{}
+		attemptCtx, cancel := context.WithTimeout(withRateLimitHint(context.WithoutCancel(ctx), hint), timeout)
+		ids, err := s.store.AddDocuments(attemptCtx, job.documents)
+		if err != nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("attempt timed out after %s: %w", timeout, err)
+		}
+		cancel()
+		limited, retryAfter := hint.wait()
+		limited = limited || isRateLimited(err)
+		if limit := limiter.release(err == nil, limited); limit > 0 {
+			logger.Info(ctx, "Adjusted storage concurrency", map[string]any{"workers": limit, "rate_limited": limited})
+		}
+		if err == nil {
+			return ids, attempt, nil
+		}
+		if attempt > maxRetries || ctx.Err() != nil || isPermanent(err) {
+			return nil, attempt, err
+		}
+
+		delay := max(backoff(attempt, s.retryBaseDelay, s.retryMaxDelay), retryAfter)
+		logger.Error(ctx, "Failed to store batch, retrying", map[string]any{
+			"worker":       workerID,
+			"batch":        job.batchNum,
+			"attempt":      attempt,
+			"rate_limited": limited,
+			"retry_in":     delay.String(),
+			"error":        err.Error(),
+		})
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, attempt, err
+		}
+	}
+}
+
+// batchSources returns the pages the chunks of a batch come from, in order
+func batchSources(batch []schema.Document) []string {
+	var sources []string
+	for _, doc := range batch {
+		if source, _ := doc.Metadata["source"].(string); source != "" && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
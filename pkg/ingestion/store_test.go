@@ -0,0 +1,275 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"logging"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// flakyStore fails the attempts for which fail returns an error. Batches are
+// identified by the content of their first document.
+type flakyStore struct {
+	fail func(ctx context.Context, first string, attempt int) error
+
+	mu       sync.Mutex
+	attempts map[string]int
+	stored   []string
+}
+
+func (s *flakyStore) AddDocuments(ctx context.Context, docs []schema.Document, _ ...vectorstores.Option) ([]string, error) {
+	first := docs[0].PageContent
+	s.mu.Lock()
+	s.attempts[first]++
+	attempt := s.attempts[first]
+	s.mu.Unlock()
+
+	if err := s.fail(ctx, first, attempt); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.PageContent
+		s.stored = append(s.stored, doc.PageContent)
+	}
+	return ids, nil
+}
+
+func (s *flakyStore) SimilaritySearch(context.Context, string, int, ...vectorstores.Option) ([]schema.Document, error) {
+	return nil, nil
+}
+
+// testChunks returns n chunks, "0" to "n-1", three per page
+func testChunks(n int) []schema.Document {
+	docs := make([]schema.Document, n)
+	for i := range docs {
+		docs[i] = schema.Document{PageContent: fmt.Sprint(i), Metadata: map[string]any{"source": fmt.Sprintf("page%d", i/3)}}
+	}
+	return docs
+}
+
+// newTestStore stores batches of two chunks with one initial worker and
+// retry delays short enough for tests
+func newTestStore(fail func(ctx context.Context, first string, attempt int) error) (*Store, *flakyStore) {
+	vectors := &flakyStore{fail: fail, attempts: map[string]int{}}
+	s := NewStore(vectors, 2, 1, logging.New())
+	s.MaxRetries = 3
+	s.retryBaseDelay = time.Millisecond
+	s.retryMaxDelay = 5 * time.Millisecond
+	return s, vectors
+}
+
+func TestStoreRetriesFailedBatches(t *testing.T) {
+	s, vectors := newTestStore(func(_ context.Context, first string, attempt int) error {
+		if first == "2" && attempt <= 2 {
+			return errors.New("API returned unexpected status code: 429: Too Many Requests")
+		}
+		if first == "4" && attempt == 1 {
+			return errors.New("connection reset by peer")
+		}
+		return nil
+	})
+
+	batches, failed, err := s.Add(context.Background(), testChunks(6), noopProgress{}, nil)
+	if err != nil || batches != 3 || len(failed) != 0 {
+		t.Fatalf("Add = %d, %v, %v, want 3 batches stored", batches, failed, err)
+	}
+	if vectors.attempts["2"] != 3 || vectors.attempts["4"] != 2 {
+		t.Errorf("attempts = %v, want batch 2 stored on its 3rd attempt and batch 3 on its 2nd", vectors.attempts)
+	}
+}
+
+func TestStoreGivesUpOnABatch(t *testing.T) {
+	// The first batch fails for good before any other is stored; the
+	// ingestion goes on with the next ones
+	s, vectors := newTestStore(func(_ context.Context, first string, _ int) error {
+		if first == "0" {
+			return errors.New("internal error")
+		}
+		return nil
+	})
+	s.MaxWorkers = 1
+
+	progress := &recordingProgress{}
+	batches, failed, err := s.Add(context.Background(), testChunks(7), progress, nil)
+	if err != nil {
+		t.Fatalf("Add failed although later batches were stored: %v", err)
+	}
+	if batches != 3 {
+		t.Errorf("stored %d batches, want 3", batches)
+	}
+	want := []FailedBatch{{Batch: 1, Chunks: 2, Attempts: 4, Error: "internal error", Sources: []string{"page0"}}}
+	if len(failed) != 1 || failed[0].Batch != 1 || failed[0].Attempts != 4 || failed[0].Error != want[0].Error || !slices.Equal(failed[0].Sources, want[0].Sources) {
+		t.Errorf("failed = %+v, want %+v", failed, want)
+	}
+	if vectors.attempts["0"] != 4 {
+		t.Errorf("batch 1 was attempted %d times, want 1 + MaxRetries", vectors.attempts["0"])
+	}
+	if !slices.Equal(progress.failed, []int{1}) {
+		t.Errorf("progress reported failed batches %v, want [1]", progress.failed)
+	}
+	slices.Sort(vectors.stored)
+	if want := []string{"2", "3", "4", "5", "6"}; !slices.Equal(vectors.stored, want) {
+		t.Errorf("stored %v, want %v", vectors.stored, want)
+	}
+}
+
+func TestStoreFailsWhenEveryBatchFails(t *testing.T) {
+	s, vectors := newTestStore(func(context.Context, string, int) error {
+		return errors.New("API returned unexpected status code: 401: Incorrect API key provided")
+	})
+
+	batches, failed, err := s.Add(context.Background(), testChunks(6), noopProgress{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "Incorrect API key") {
+		t.Fatalf("Add = %v, want the provider error", err)
+	}
+	if batches != 0 || len(failed) != 3 {
+		t.Errorf("Add = %d stored, %d failed, want 0 and 3", batches, len(failed))
+	}
+	// Authentication errors are not retried
+	for first, attempts := range vectors.attempts {
+		if attempts != 1 {
+			t.Errorf("batch starting with %s was attempted %d times, want 1", first, attempts)
+		}
+	}
+}
+
+func TestStoreCountsEarlierBatches(t *testing.T) {
+	s, vectors := newTestStore(func(_ context.Context, first string, _ int) error {
+		if first == "4" {
+			return errors.New("internal error")
+		}
+		return nil
+	})
+
+	// Batches 1 and 2 were stored by an earlier run; the only batch left
+	// fails, so every attempted batch failed
+	batches, failed, err := s.Add(context.Background(), testChunks(6), noopProgress{}, map[int]bool{1: true, 2: true})
+	if err == nil || batches != 2 || len(failed) != 1 {
+		t.Fatalf("Add = %d, %v, %v, want 2 batches counted, batch 3 failed and an error", batches, failed, err)
+	}
+	if vectors.attempts["0"] != 0 || vectors.attempts["2"] != 0 {
+		t.Errorf("batches stored earlier were stored again: %v", vectors.attempts)
+	}
+}
+
+func TestStoreRetriesTimedOutAttempts(t *testing.T) {
+	s, vectors := newTestStore(func(ctx context.Context, first string, attempt int) error {
+		if first == "0" && attempt == 1 {
+			<-ctx.Done() // A provider call that hangs
+			return ctx.Err()
+		}
+		return nil
+	})
+	s.BatchTimeout = 20 * time.Millisecond
+
+	batches, failed, err := s.Add(context.Background(), testChunks(4), noopProgress{}, nil)
+	if err != nil || batches != 2 || len(failed) != 0 {
+		t.Fatalf("Add = %d, %v, %v, want 2 batches stored", batches, failed, err)
+	}
+	if vectors.attempts["0"] != 2 {
+		t.Errorf("batch 1 was attempted %d times, want 2", vectors.attempts["0"])
+	}
+}
+
+func TestStoreStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s, vectors := newTestStore(func(_ context.Context, first string, _ int) error {
+		if first == "0" {
+			cancel()
+		}
+		return nil
+	})
+	s.MaxWorkers = 1
+
+	batches, _, err := s.Add(ctx, testChunks(10), noopProgress{}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Add = %v, want context.Canceled", err)
+	}
+	if batches != 1 || len(vectors.stored) != 2 {
+		t.Errorf("stored %d batches (%v), want only the batch in flight when cancelled", batches, vectors.stored)
+	}
+}
+
+// recordingProgress records the batches reported as failed
+type recordingProgress struct {
+	noopProgress
+	mu     sync.Mutex
+	failed []int
+}
+
+func (p *recordingProgress) BatchFailed(batchNum, _ int, _ error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failed = append(p.failed, batchNum)
+}
+
+// pagesCrawler returns one page per entry of pages
+type pagesCrawler struct{ pages []string }
+
+func (c pagesCrawler) Crawl(_ context.Context, url string, _ Options) (CrawlResult, error) {
+	docs := make([]schema.Document, len(c.pages))
+	for i, content := range c.pages {
+		docs[i] = schema.Document{PageContent: content, Metadata: map[string]any{"source": fmt.Sprintf("%s/page%d", url, i)}}
+	}
+	return CrawlResult{BaseURL: url, Documents: docs}, nil
+}
+
+// pageSplitter makes every page a single chunk
+type pageSplitter struct{}
+
+func (pageSplitter) Split(docs []schema.Document) ([]schema.Document, error) { return docs, nil }
+
+func TestPipelineStoresFailedBatchesOnNextRun(t *testing.T) {
+	failing := true
+	s, vectors := newTestStore(func(_ context.Context, first string, _ int) error {
+		if failing && first == "beta" {
+			return errors.New("internal error")
+		}
+		return nil
+	})
+	s.batchSize = 1
+	manifest := NewManifest()
+	pipeline := &Pipeline{
+		Crawler:  pagesCrawler{pages: []string{"alpha", "beta", "gamma"}},
+		Splitter: pageSplitter{},
+		Store:    s,
+		Logger:   logging.New(),
+		Options:  Options{Manifest: manifest},
+	}
+
+	result, err := pipeline.Run(context.Background(), "https://example.com")
+	if err != nil {
+		t.Fatalf("Run failed because of one failed batch: %v", err)
+	}
+	if result.BatchesStored != 2 || len(result.FailedBatches) != 1 || result.FailedBatches[0].Batch != 2 {
+		t.Fatalf("result = %+v, want 2 batches stored and batch 2 failed", result)
+	}
+	pages := manifest.pages("https://example.com")
+	if len(pages["https://example.com/page0"]) != 1 || len(pages["https://example.com/page1"]) != 0 {
+		t.Fatalf("manifest = %v, want no chunk recorded for the failed page", pages)
+	}
+
+	failing = false
+	vectors.stored = nil
+	result, err = pipeline.Run(context.Background(), "https://example.com")
+	if err != nil || len(result.FailedBatches) != 0 {
+		t.Fatalf("second Run = %+v, %v", result, err)
+	}
+	if !slices.Equal(vectors.stored, []string{"beta"}) {
+		t.Errorf("second run stored %v, want only the chunk that failed before", vectors.stored)
+	}
+	if pages := manifest.pages("https://example.com"); len(pages["https://example.com/page1"]) != 1 {
+		t.Errorf("manifest = %v, want the failed page recorded", pages)
+	}
+}
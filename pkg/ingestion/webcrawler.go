@@ -0,0 +1,533 @@
+package ingestion
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Web crawlers accepted in Options.WebCrawler
+const (
+	WebCrawlerTavily = "tavily"
+	WebCrawlerNative = "native"
+)
+
+// maxPageSize caps how much of a response body is read
+const maxPageSize = 10 << 20
+
+// WebCrawler crawls a documentation site over HTTP without external services.
+// Starting from the given URL it follows links breadth first up to
+// Options.MaxDepth, fetches at most Options.Limit pages and follows at most
+// Options.MaxBreadth new links per page. Pages on other hosts are skipped unless
+// Options.AllowOtherHosts is set, and URLs must match Options.Include (when set)
+// and must not match Options.Exclude; the start URL is always fetched.
+//
+// The start host's robots.txt rules for the crawler's user agent are honoured and the site's
+// sitemaps (from robots.txt, or /sitemap.xml) seed the crawl with the pages
+// below the start URL's path. Redirects are only followed to URLs that pass
+// the same host, pattern and robots.txt checks as links. HTML pages are converted to text with ExtractHTML;
+// every document carries the page URL as "source" and its "title".
+type WebCrawler struct {
+	// Client performs the requests; nil uses http.DefaultClient
+	Client *http.Client
+	// UserAgent is sent with every request and matched against robots.txt groups
+	UserAgent string
+	// IgnoreRobots skips fetching robots.txt
+	IgnoreRobots bool
+	// IgnoreSitemap skips seeding the crawl from sitemaps
+	IgnoreSitemap bool
+}
+
+// DefaultUserAgent identifies WebCrawler when no UserAgent is configured
+const DefaultUserAgent = "documentation-assistant"
+
+// crawlTarget is a URL waiting to be fetched and its link depth from the start URL
+type crawlTarget struct {
+	url   string
+	depth int
+}
+
+// Crawl fetches the pages reachable from startURL within the limits of opts
+func (c *WebCrawler) Crawl(ctx context.Context, startURL string, opts Options) (CrawlResult, error) {
+	start, err := url.Parse(startURL)
+	if err != nil {
+		return CrawlResult{}, fmt.Errorf("invalid url %q: %w", startURL, err)
+	}
+	if start.Scheme != "http" && start.Scheme != "https" || start.Host == "" {
+		return CrawlResult{}, fmt.Errorf("invalid url %q: only absolute http and https URLs can be crawled", startURL)
+	}
+	start.Fragment = ""
+
+	filter, err := newURLFilter(start, opts)
+	if err != nil {
+		return CrawlResult{}, err
+	}
+
+	var robots *robotsRules
+	if !c.IgnoreRobots {
+		robots = c.fetchRobots(ctx, start)
+		if robots != nil && !robots.allowed(start.String()) {
+			return CrawlResult{}, fmt.Errorf("robots.txt disallows crawling %s", start)
+		}
+	}
+
+	client := c.pageClient(filter, robots)
+	queue := []crawlTarget{{url: start.String()}}
+	seen := map[string]bool{start.String(): true}
+	if !c.IgnoreSitemap {
+		for _, loc := range c.sitemapURLs(ctx, start, robots, opts.Limit) {
+			if !seen[loc] && filter.allows(loc) && sitemapCovers(start, loc) {
+				seen[loc] = true
+				queue = append(queue, crawlTarget{url: loc, depth: 1})
+			}
+		}
+	}
+
+	var docs []schema.Document
+	var firstErr error
+	for len(queue) > 0 && len(docs) < opts.Limit {
+		if err := ctx.Err(); err != nil {
+			return CrawlResult{}, err
+		}
+		target := queue[0]
+		queue = queue[1:]
+
+		if robots != nil && !robots.allowed(target.url) {
+			continue
+		}
+
+		page, err := c.fetchPage(ctx, client, target.url)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if page == nil {
+			continue // Not a text page
+		}
+		docs = append(docs, schema.Document{
+			PageContent: page.text,
+			Metadata: map[string]any{
+				"source": page.url,
+				"title":  page.title,
+			},
+		})
+
+		if target.depth >= opts.MaxDepth {
+			continue
+		}
+		followed := 0
+		for _, link := range page.links {
+			if followed >= opts.MaxBreadth {
+				break
+			}
+			if seen[link] || !filter.allows(link) {
+				continue
+			}
+			seen[link] = true
+			followed++
+			queue = append(queue, crawlTarget{url: link, depth: target.depth + 1})
+		}
+	}
+
+	if len(docs) == 0 && firstErr != nil {
+		return CrawlResult{}, firstErr
+	}
+	return CrawlResult{BaseURL: start.String(), Documents: docs}, nil
+}
+
+// crawledPage is the readable content of a fetched page
+type crawledPage struct {
+	url   string // Final URL after redirects
+	title string
+	text  string
+	links []string // Absolute URLs without fragments
+}
+
+// fetchPage downloads rawURL with client and extracts its text. It returns
+// nil, nil for responses that are not HTML or plain text.
+func (c *WebCrawler) fetchPage(ctx context.Context, client *http.Client, rawURL string) (*crawledPage, error) {
+	resp, err := c.get(ctx, client, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	body := io.LimitReader(resp.Body, maxPageSize)
+	page := &crawledPage{url: resp.Request.URL.String()}
+
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		extracted, err := ExtractHTML(body)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", rawURL, err)
+		}
+		page.title = extracted.Title
+		page.text = extracted.Text
+		for _, href := range extracted.Links {
+			if link, ok := resolveLink(resp.Request.URL, href); ok {
+				page.links = append(page.links, link)
+			}
+		}
+	case "text/plain", "text/markdown":
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", rawURL, err)
+		}
+		page.text = string(content)
+	default:
+		return nil, nil
+	}
+	return page, nil
+}
+
+func (c *WebCrawler) get(ctx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent())
+	return client.Do(req)
+}
+
+func (c *WebCrawler) client() *http.Client {
+	if c.Client == nil {
+		return http.DefaultClient
+	}
+	return c.Client
+}
+
+// maxRedirects is how many redirects a page fetch follows, as in net/http
+const maxRedirects = 10
+
+// pageClient returns a copy of the crawler's client that refuses redirects to
+// URLs the crawl would not follow as links, so a redirect cannot take the
+// crawler to another host or to a path excluded by the patterns or robots.txt
+func (c *WebCrawler) pageClient(filter *urlFilter, robots *robotsRules) *http.Client {
+	client := *c.client()
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		target := req.URL.String()
+		if !filter.allows(target) || robots != nil && !robots.allowed(target) {
+			return fmt.Errorf("redirect to %s leaves the crawl", target)
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+	return &client
+}
+
+func (c *WebCrawler) userAgent() string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+	return DefaultUserAgent
+}
+
+// resolveLink makes href absolute against base and drops its fragment. Only
+// http and https links are returned.
+func resolveLink(base *url.URL, href string) (string, bool) {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", false
+	}
+	link := base.ResolveReference(ref)
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return "", false
+	}
+	link.Fragment = ""
+	return link.String(), true
+}
+
+// urlFilter decides which discovered URLs are crawled
+type urlFilter struct {
+	host            string
+	allowOtherHosts bool
+	include         []*regexp.Regexp
+	exclude         []*regexp.Regexp
+}
+
+func newURLFilter(start *url.URL, opts Options) (*urlFilter, error) {
+	include, err := CompilePatterns(opts.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := CompilePatterns(opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &urlFilter{
+		host:            strings.ToLower(start.Host),
+		allowOtherHosts: opts.AllowOtherHosts,
+		include:         include,
+		exclude:         exclude,
+	}, nil
+}
+
+func (f *urlFilter) allows(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if !f.allowOtherHosts && strings.ToLower(u.Host) != f.host {
+		return false
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(rawURL) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(rawURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompilePatterns compiles URL patterns, reporting the first invalid one
+func CompilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// robotsRule is one Allow or Disallow line of robots.txt
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// robotsRules are the robots.txt rules that apply to the crawler
+type robotsRules struct {
+	rules    []robotsRule
+	sitemaps []string
+}
+
+// fetchRobots reads the site's robots.txt. A missing or unreadable file allows everything.
+func (c *WebCrawler) fetchRobots(ctx context.Context, start *url.URL) *robotsRules {
+	robotsURL := &url.URL{Scheme: start.Scheme, Host: start.Host, Path: "/robots.txt"}
+	resp, err := c.get(ctx, c.client(), robotsURL.String())
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, maxPageSize), c.userAgent())
+}
+
+// parseRobots keeps the rules of the group matching userAgent, falling back to
+// the "*" group, plus every Sitemap line.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	agent := strings.ToLower(userAgent)
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+
+	robots := &robotsRules{}
+	var specific, wildcard []robotsRule
+	var groupAgents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				groupAgents = nil
+				inRules = false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue // An empty Disallow allows everything
+			}
+			rule := robotsRule{pattern: value, allow: key == "allow"}
+			for _, a := range groupAgents {
+				switch {
+				case a == "*":
+					wildcard = append(wildcard, rule)
+				case agent != "" && strings.Contains(agent, a):
+					specific = append(specific, rule)
+				}
+			}
+		case "sitemap":
+			robots.sitemaps = append(robots.sitemaps, value)
+		}
+	}
+
+	robots.rules = wildcard
+	if len(specific) > 0 {
+		robots.rules = specific
+	}
+	return robots
+}
+
+// allowed applies the longest matching rule to the URL's path; Allow wins ties
+func (r *robotsRules) allowed(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if n := len(rule.pattern); n > best || n == best && rule.allow {
+			best, allow = n, rule.allow
+		}
+	}
+	return allow
+}
+
+// robotsMatch matches path against a robots.txt pattern, where "*" matches any
+// sequence and a trailing "$" anchors the end of the path.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return !anchored || rest == ""
+}
+
+// sitemapDocument covers both <urlset> and <sitemapindex> documents
+type sitemapDocument struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapURLs lists up to limit page URLs from the site's sitemaps, following
+// one level of sitemap indexes
+func (c *WebCrawler) sitemapURLs(ctx context.Context, start *url.URL, robots *robotsRules, limit int) []string {
+	var sitemaps []string
+	if robots != nil {
+		sitemaps = robots.sitemaps
+	}
+	if len(sitemaps) == 0 {
+		sitemaps = []string{(&url.URL{Scheme: start.Scheme, Host: start.Host, Path: "/sitemap.xml"}).String()}
+	}
+
+	var pages []string
+	for depth := 0; depth < 2 && len(sitemaps) > 0; depth++ {
+		var nested []string
+		for _, sitemap := range sitemaps {
+			doc, ok := c.fetchSitemap(ctx, sitemap)
+			if !ok {
+				continue
+			}
+			for _, u := range doc.URLs {
+				if len(pages) >= limit {
+					return pages
+				}
+				if link, ok := resolveLink(start, u.Loc); ok {
+					pages = append(pages, link)
+				}
+			}
+			for _, s := range doc.Sitemaps {
+				nested = append(nested, strings.TrimSpace(s.Loc))
+			}
+		}
+		sitemaps = nested
+	}
+	return pages
+}
+
+func (c *WebCrawler) fetchSitemap(ctx context.Context, rawURL string) (sitemapDocument, bool) {
+	resp, err := c.get(ctx, c.client(), rawURL)
+	if err != nil {
+		return sitemapDocument{}, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return sitemapDocument{}, false
+	}
+
+	var doc sitemapDocument
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxPageSize)).Decode(&doc); err != nil {
+		return sitemapDocument{}, false
+	}
+	return doc, true
+}
+
+// sitemapCovers reports whether a sitemap entry lies below the start URL, so
+// ingesting /docs/ does not pull in the rest of the site
+func sitemapCovers(start *url.URL, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	prefix := start.Path
+	if i := strings.LastIndexByte(prefix, '/'); i >= 0 {
+		prefix = prefix[:i+1]
+	}
+	return strings.EqualFold(u.Host, start.Host) && strings.HasPrefix(u.Path, prefix)
+}
@@ -0,0 +1,261 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testSite serves pages by path. "{{base}}" in a body is replaced with the
+// site's URL, a body starting with "redirect:" redirects to the rest of it,
+// and paths without a page answer 404.
+func testSite(t *testing.T, pages map[string]string) *httptest.Server {
+	t.Helper()
+	var site *httptest.Server
+	site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body = strings.ReplaceAll(body, "{{base}}", site.URL)
+		if target, ok := strings.CutPrefix(body, "redirect:"); ok {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		switch {
+		case r.URL.Path == "/robots.txt":
+			w.Header().Set("Content-Type", "text/plain")
+		case strings.HasSuffix(r.URL.Path, ".xml"):
+			w.Header().Set("Content-Type", "application/xml")
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+// linkPage is an HTML page titled title linking to hrefs
+func linkPage(title string, hrefs ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<html><head><title>%s</title></head><body><h1>%s</h1>", title, title)
+	for _, href := range hrefs {
+		fmt.Fprintf(&b, `<a href="%s">%s</a>`, href, href)
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
+
+// crawlPaths crawls path of site and returns the paths of the crawled pages
+func crawlPaths(t *testing.T, crawler *WebCrawler, site *httptest.Server, path string, opts Options) []string {
+	t.Helper()
+	result, err := crawler.Crawl(context.Background(), site.URL+path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, doc := range result.Documents {
+		paths = append(paths, strings.TrimPrefix(doc.Metadata["source"].(string), site.URL))
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func crawlOptions(configure func(*Options)) Options {
+	opts := DefaultOptions()
+	opts.MaxDepth = 3
+	configure(&opts)
+	return opts
+}
+
+func TestWebCrawlerHonoursRobots(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"/robots.txt":          "User-agent: other\nDisallow: /\n\nUser-agent: *\nDisallow: /docs/private\nAllow: /docs/private/public\n",
+		"/docs/":               linkPage("Docs", "a", "private/b", "private/public"),
+		"/docs/a":              linkPage("A"),
+		"/docs/private/b":      linkPage("B"),
+		"/docs/private/public": linkPage("Public"),
+	})
+
+	got := crawlPaths(t, &WebCrawler{IgnoreSitemap: true}, site, "/docs/", crawlOptions(func(*Options) {}))
+	want := []string{"/docs/", "/docs/a", "/docs/private/public"}
+	if !slices.Equal(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+
+	got = crawlPaths(t, &WebCrawler{IgnoreSitemap: true, IgnoreRobots: true}, site, "/docs/", crawlOptions(func(*Options) {}))
+	if len(got) != 4 {
+		t.Errorf("crawled %v ignoring robots.txt, want every page", got)
+	}
+
+	if _, err := (&WebCrawler{UserAgent: "other-bot/1.0"}).Crawl(context.Background(), site.URL+"/docs/", crawlOptions(func(*Options) {})); err == nil {
+		t.Error("crawling a start URL disallowed for the user agent succeeded")
+	}
+}
+
+func TestWebCrawlerDiscoversSitemaps(t *testing.T) {
+	sitemap := func(paths ...string) string {
+		var b strings.Builder
+		b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+		for _, path := range paths {
+			fmt.Fprintf(&b, "<url><loc>{{base}}%s</loc></url>", path)
+		}
+		b.WriteString("</urlset>")
+		return b.String()
+	}
+
+	t.Run("default location", func(t *testing.T) {
+		site := testSite(t, map[string]string{
+			"/sitemap.xml":   sitemap("/docs/unlinked", "/blog/post"),
+			"/docs/":         linkPage("Docs"),
+			"/docs/unlinked": linkPage("Unlinked"),
+			"/blog/post":     linkPage("Post"),
+		})
+		got := crawlPaths(t, &WebCrawler{}, site, "/docs/", crawlOptions(func(*Options) {}))
+		if want := []string{"/docs/", "/docs/unlinked"}; !slices.Equal(got, want) {
+			t.Errorf("crawled %v, want %v", got, want)
+		}
+	})
+
+	t.Run("robots.txt and sitemap index", func(t *testing.T) {
+		site := testSite(t, map[string]string{
+			"/robots.txt": "Sitemap: {{base}}/maps/index.xml\n",
+			"/maps/index.xml": `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` +
+				`<sitemap><loc>{{base}}/maps/docs.xml</loc></sitemap></sitemapindex>`,
+			"/maps/docs.xml": sitemap("/docs/deep"),
+			"/docs/":         linkPage("Docs"),
+			"/docs/deep":     linkPage("Deep"),
+		})
+		got := crawlPaths(t, &WebCrawler{}, site, "/docs/", crawlOptions(func(*Options) {}))
+		if want := []string{"/docs/", "/docs/deep"}; !slices.Equal(got, want) {
+			t.Errorf("crawled %v, want %v", got, want)
+		}
+
+		got = crawlPaths(t, &WebCrawler{IgnoreSitemap: true}, site, "/docs/", crawlOptions(func(*Options) {}))
+		if want := []string{"/docs/"}; !slices.Equal(got, want) {
+			t.Errorf("crawled %v ignoring sitemaps, want %v", got, want)
+		}
+	})
+}
+
+func TestWebCrawlerIncludeExclude(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"/docs/":         linkPage("Docs", "/docs/v2/a", "/docs/v1/a", "/blog/b"),
+		"/docs/v2/a":     linkPage("V2"),
+		"/docs/v1/a":     linkPage("V1"),
+		"/blog/b":        linkPage("Blog"),
+		"/docs/v2/other": linkPage("Other"),
+	})
+
+	got := crawlPaths(t, &WebCrawler{IgnoreSitemap: true}, site, "/docs/", crawlOptions(func(o *Options) {
+		o.Include = []string{"/docs/"}
+		o.Exclude = []string{"/docs/v1/"}
+	}))
+	if want := []string{"/docs/", "/docs/v2/a"}; !slices.Equal(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+
+	// The start URL is fetched even when the patterns reject it
+	got = crawlPaths(t, &WebCrawler{IgnoreSitemap: true}, site, "/docs/", crawlOptions(func(o *Options) {
+		o.Exclude = []string{"/docs/$"}
+		o.Include = []string{"/blog/"}
+	}))
+	if want := []string{"/blog/b", "/docs/"}; !slices.Equal(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+
+	if _, err := (&WebCrawler{}).Crawl(context.Background(), site.URL+"/docs/", crawlOptions(func(o *Options) {
+		o.Include = []string{"("}
+	})); err == nil {
+		t.Error("crawling with an invalid pattern succeeded")
+	}
+}
+
+func TestWebCrawlerStaysOnHost(t *testing.T) {
+	other := testSite(t, map[string]string{"/page": linkPage("Elsewhere")})
+	site := testSite(t, map[string]string{
+		"/docs/":  linkPage("Docs", "a", other.URL+"/page"),
+		"/docs/a": linkPage("A"),
+	})
+
+	got := crawlPaths(t, &WebCrawler{IgnoreSitemap: true}, site, "/docs/", crawlOptions(func(*Options) {}))
+	if want := []string{"/docs/", "/docs/a"}; !slices.Equal(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+
+	got = crawlPaths(t, &WebCrawler{IgnoreSitemap: true}, site, "/docs/", crawlOptions(func(o *Options) {
+		o.AllowOtherHosts = true
+	}))
+	if want := []string{"/docs/", "/docs/a", other.URL + "/page"}; !slices.Equal(got, want) {
+		t.Errorf("crawled %v allowing other hosts, want %v", got, want)
+	}
+}
+
+func TestWebCrawlerLimits(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"/docs/":  linkPage("Docs", "1", "a", "b", "c"),
+		"/docs/1": linkPage("1", "2"),
+		"/docs/2": linkPage("2", "3"),
+		"/docs/3": linkPage("3"),
+		"/docs/a": linkPage("A"),
+		"/docs/b": linkPage("B"),
+		"/docs/c": linkPage("C"),
+	})
+	crawler := &WebCrawler{IgnoreSitemap: true}
+
+	tests := []struct {
+		name      string
+		configure func(*Options)
+		want      []string
+	}{
+		{"depth 0", func(o *Options) { o.MaxDepth = 0 }, []string{"/docs/"}},
+		{"depth 2", func(o *Options) { o.MaxDepth = 2 }, []string{"/docs/", "/docs/1", "/docs/2", "/docs/a", "/docs/b", "/docs/c"}},
+		{"limit", func(o *Options) { o.Limit = 3 }, []string{"/docs/", "/docs/1", "/docs/a"}},
+		{"breadth", func(o *Options) { o.MaxBreadth = 2 }, []string{"/docs/", "/docs/1", "/docs/2", "/docs/3", "/docs/a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := crawlPaths(t, crawler, site, "/docs/", crawlOptions(tt.configure))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("crawled %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebCrawlerChecksRedirects(t *testing.T) {
+	var otherHits int
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherHits++
+		fmt.Fprint(w, linkPage("Elsewhere"))
+	}))
+	t.Cleanup(other.Close)
+
+	site := testSite(t, map[string]string{
+		"/robots.txt":       "User-agent: *\nDisallow: /docs/secret\n",
+		"/docs/":            linkPage("Docs", "moved", "away", "old-private", "sneaky"),
+		"/docs/moved":       "redirect:{{base}}/docs/new",
+		"/docs/away":        "redirect:" + other.URL + "/page",
+		"/docs/old-private": "redirect:{{base}}/private/page",
+		"/docs/sneaky":      "redirect:{{base}}/docs/secret",
+		"/docs/new":         linkPage("New"),
+		"/docs/secret":      linkPage("Secret"),
+		"/private/page":     linkPage("Private"),
+	})
+
+	got := crawlPaths(t, &WebCrawler{IgnoreSitemap: true}, site, "/docs/", crawlOptions(func(opts *Options) {
+		opts.Exclude = []string{"/private/"}
+	}))
+	if want := []string{"/docs/", "/docs/new"}; !slices.Equal(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+	if otherHits != 0 {
+		t.Errorf("the crawler followed a redirect to another host %d times", otherHits)
+	}
+}
@@ -0,0 +1,274 @@
+// Package keyword provides a BM25 full-text index over document chunks. It
+// complements dense vector search, which tends to miss exact identifiers such
+// as API names, error codes and command line flags.
+package keyword
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// BM25 parameters
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// tokenPattern matches words, keeping identifiers joined by '.', '-', ':' or
+// '/' together, e.g. vectorstores.ToRetriever, max-depth or ERR_TIMEOUT
+var tokenPattern = regexp.MustCompile(`[\p{L}\p{N}_]+(?:[.\-:/][\p{L}\p{N}_]+)*`)
+
+// document is an indexed chunk
+type document struct {
+	ID       string         `json:"id"`
+	Content  string         `json:"content"`
+	Metadata map[string]any `json:"metadata"`
+
+	terms  map[string]int // Term frequencies, rebuilt on load
+	length int
+}
+
+// indexFile is the on-disk layout of an Index
+type indexFile struct {
+	Documents []document `json:"documents"`
+}
+
+// Index is a BM25 index of chunks keyed by their vectorstore.ChunkIDKey. It
+// is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	path     string // Empty keeps the index in memory only
+	docs     map[string]*document
+	postings map[string]map[string]int // Term to document ID to term frequency
+	totalLen int
+}
+
+// NewIndex creates an empty index that lives in memory only
+func NewIndex() *Index {
+	return &Index{docs: map[string]*document{}, postings: map[string]map[string]int{}}
+}
+
+// Open loads the index saved at path, or starts an empty one if the file does
+// not exist. Every change is written back to path.
+func Open(path string) (*Index, error) {
+	idx := NewIndex()
+	idx.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyword index: %w", err)
+	}
+
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keyword index %s: %w", path, err)
+	}
+	for _, doc := range file.Documents {
+		idx.add(doc)
+	}
+	return idx, nil
+}
+
+// Len returns the number of indexed chunks
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Update indexes docs and removes the chunks whose IDs are in remove. A
+// chunk's ID identifies its content, so documents already indexed under their
+// ID are left as they are, like unchanged chunks in the vector store.
+// Documents without an ID are skipped.
+func (idx *Index) Update(docs []schema.Document, remove []string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, id := range remove {
+		idx.remove(id)
+	}
+	for _, doc := range docs {
+		id, _ := doc.Metadata[vectorstore.ChunkIDKey].(string)
+		if _, indexed := idx.docs[id]; indexed || id == "" {
+			continue
+		}
+		idx.add(document{ID: id, Content: doc.PageContent, Metadata: doc.Metadata})
+	}
+	return idx.save()
+}
+
+// DeleteSource removes the chunks whose source metadata equals source, or
+// every chunk when source is empty, and returns how many were removed
+func (idx *Index) DeleteSource(source string) (int, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	deleted := 0
+	for id, doc := range idx.docs {
+		if s, _ := doc.Metadata["source"].(string); source == "" || s == source {
+			idx.remove(id)
+			deleted++
+		}
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	return deleted, idx.save()
+}
+
+// Search returns up to numDocuments chunks ranked by their BM25 score for
+// query, highest first. Chunks sharing no term with the query are omitted, as
+// are chunks whose metadata does not match filter (see vectorstore.MatchFilter).
+func (idx *Index) Search(query string, numDocuments int, filter map[string]any) []schema.Document {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.docs) == 0 {
+		return nil
+	}
+	n := float64(len(idx.docs))
+	avgLen := float64(idx.totalLen) / n
+
+	scores := map[string]float64{}
+	seen := map[string]bool{}
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			if !vectorstore.MatchFilter(idx.docs[id].Metadata, filter) {
+				continue
+			}
+			f := float64(tf)
+			norm := 1 - b + b*float64(idx.docs[id].length)/avgLen
+			scores[id] += idf * f * (k1 + 1) / (f + k1*norm)
+		}
+	}
+
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if numDocuments >= 0 && len(ids) > numDocuments {
+		ids = ids[:numDocuments]
+	}
+
+	docs := make([]schema.Document, 0, len(ids))
+	for _, id := range ids {
+		doc := idx.docs[id]
+		metadata := make(map[string]any, len(doc.Metadata))
+		for k, v := range doc.Metadata {
+			metadata[k] = v
+		}
+		docs = append(docs, schema.Document{
+			PageContent: doc.Content,
+			Metadata:    metadata,
+			Score:       float32(scores[id]),
+		})
+	}
+	return docs
+}
+
+// add indexes doc, replacing the chunk with the same ID. The caller must hold idx.mu.
+func (idx *Index) add(doc document) {
+	idx.remove(doc.ID)
+
+	doc.terms = map[string]int{}
+	for _, term := range Tokenize(doc.Content) {
+		doc.terms[term]++
+		doc.length++
+	}
+	for term, tf := range doc.terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = map[string]int{}
+		}
+		idx.postings[term][doc.ID] = tf
+	}
+	idx.docs[doc.ID] = &doc
+	idx.totalLen += doc.length
+}
+
+// remove drops the chunk with id, if indexed. The caller must hold idx.mu.
+func (idx *Index) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLen -= doc.length
+	delete(idx.docs, id)
+}
+
+// save atomically writes the index to idx.path. The caller must hold idx.mu.
+func (idx *Index) save() error {
+	if idx.path == "" {
+		return nil
+	}
+
+	file := indexFile{Documents: make([]document, 0, len(idx.docs))}
+	for _, doc := range idx.docs {
+		file.Documents = append(file.Documents, *doc)
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0o755); err != nil {
+		return err
+	}
+	tmp := idx.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.path)
+}
+
+// Tokenize lowercases text and splits it into terms. Compound identifiers
+// yield the whole identifier followed by each of its parts, so both
+// "vectorstores.toretriever" and "toretriever" match.
+func Tokenize(text string) []string {
+	var terms []string
+	for _, match := range tokenPattern.FindAllString(strings.ToLower(text), -1) {
+		terms = append(terms, match)
+		parts := strings.FieldsFunc(match, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+		})
+		if len(parts) > 1 {
+			terms = append(terms, parts...)
+		}
+	}
+	return terms
+}
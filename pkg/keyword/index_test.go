@@ -0,0 +1,149 @@
+package keyword
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// chunk is an indexable document with an ID, source and tags
+func chunk(id, source, content string, tags ...any) schema.Document {
+	return schema.Document{PageContent: content, Metadata: map[string]any{
+		vectorstore.ChunkIDKey: id,
+		"source":               source,
+		"tags":                 tags,
+	}}
+}
+
+var testChunks = []schema.Document{
+	chunk("retriever", "https://example.com/retrieval", "Call vectorstores.ToRetriever to turn a store into a retriever for chains.", "v1"),
+	chunk("stores", "https://example.com/retrieval", "Vector stores keep embeddings. A store is queried by similarity, and a store can be filtered.", "v1"),
+	chunk("timeout", "https://example.com/errors", "ERR_TIMEOUT is returned when the request deadline passes.", "v2"),
+	chunk("crawl", "https://example.com/cli", "Pass --max-depth to limit how deep the crawler follows links.", "v2"),
+}
+
+// ids returns the chunk IDs of docs in order
+func ids(docs []schema.Document) []string {
+	out := make([]string, len(docs))
+	for i, doc := range docs {
+		out[i], _ = doc.Metadata[vectorstore.ChunkIDKey].(string)
+	}
+	return out
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Use vectorstores.ToRetriever", []string{"use", "vectorstores.toretriever", "vectorstores", "toretriever"}},
+		{"--max-depth 3", []string{"max-depth", "max", "depth", "3"}},
+		{"ERR_TIMEOUT!", []string{"err_timeout"}},
+		{"pkg/keyword:Index", []string{"pkg/keyword:index", "pkg", "keyword", "index"}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	idx := NewIndex()
+	if err := idx.Update(testChunks, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		num    int
+		filter map[string]any
+		want   []string
+	}{
+		{"exact identifier first", "use vectorstores.ToRetriever with stores", 4, nil, []string{"retriever", "stores"}},
+		{"identifier part", "toretriever", 4, nil, []string{"retriever"}},
+		{"error code", "what does ERR_TIMEOUT mean", 4, nil, []string{"timeout"}},
+		{"flag", "max-depth", 4, nil, []string{"crawl"}},
+		{"term frequency", "store", 4, nil, []string{"stores", "retriever"}},
+		{"limit", "store", 1, nil, []string{"stores"}},
+		{"no shared term", "kubernetes", 4, nil, []string{}},
+		{"filter by source", "stores ERR_TIMEOUT", 4, map[string]any{"source": "https://example.com/errors"}, []string{"timeout"}},
+		{"filter by tag", "store max-depth", 4, map[string]any{"tags": map[string]any{"$in": []any{"v2"}}}, []string{"crawl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idx.Search(tt.query, tt.num, tt.filter)
+			if !slices.Equal(ids(got), tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, ids(got), tt.want)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].Score > got[i-1].Score {
+					t.Errorf("results not ordered by score: %v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateAndDeleteSource(t *testing.T) {
+	idx := NewIndex()
+	if err := idx.Update(testChunks, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A known ID keeps its indexed content; chunks without an ID are skipped
+	changed := chunk("timeout", "https://example.com/errors", "rewritten")
+	if err := idx.Update([]schema.Document{changed, {PageContent: "no id"}}, []string{"crawl"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(idx.Search("ERR_TIMEOUT", 4, nil)); !slices.Equal(got, []string{"timeout"}) {
+		t.Errorf("after updating a known ID, ERR_TIMEOUT finds %v", got)
+	}
+	if idx.Len() != 3 || len(idx.Search("max-depth", 4, nil)) != 0 {
+		t.Errorf("removed chunk still indexed: %d chunks", idx.Len())
+	}
+
+	deleted, err := idx.DeleteSource("https://example.com/retrieval")
+	if err != nil || deleted != 2 {
+		t.Fatalf("DeleteSource = %d, %v; want 2 chunks", deleted, err)
+	}
+	if got := ids(idx.Search("store vectorstores.ToRetriever", 4, nil)); len(got) != 0 {
+		t.Errorf("chunks of the deleted source still found: %v", got)
+	}
+	if deleted, _ := idx.DeleteSource(""); deleted != 1 || idx.Len() != 0 {
+		t.Errorf("DeleteSource(\"\") removed %d chunks, %d left", deleted, idx.Len())
+	}
+}
+
+func TestOpenRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.json")
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Update(testChunks, []string{"unknown"}); err != nil {
+		t.Fatal(err)
+	}
+	want := idx.Search("stores ERR_TIMEOUT max-depth", 4, nil)
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != len(testChunks) {
+		t.Fatalf("reopened index holds %d chunks, want %d", reopened.Len(), len(testChunks))
+	}
+	got := reopened.Search("stores ERR_TIMEOUT max-depth", 4, nil)
+	if !slices.Equal(ids(got), ids(want)) {
+		t.Errorf("reopened index ranks %v, want %v", ids(got), ids(want))
+	}
+	for i := range got {
+		if got[i].Score != want[i].Score || got[i].Metadata["source"] != want[i].Metadata["source"] {
+			t.Errorf("result %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package rerank
+
+import (
+	"context"
+
+	"github.com/avivnoah/documentation-assistant/pkg/keyword"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Lexical scores a document with the share of the query's distinct terms it
+// contains, from 0 to 1. It needs no model, so it works offline.
+type Lexical struct{}
+
+var _ Reranker = Lexical{}
+
+func (Lexical) Score(_ context.Context, query string, docs []schema.Document) ([]float64, error) {
+	queryTerms := map[string]bool{}
+	for _, term := range keyword.Tokenize(query) {
+		queryTerms[term] = true
+	}
+
+	scores := make([]float64, len(docs))
+	if len(queryTerms) == 0 {
+		return scores, nil
+	}
+	for i, doc := range docs {
+		found := map[string]bool{}
+		for _, term := range keyword.Tokenize(doc.PageContent) {
+			if queryTerms[term] {
+				found[term] = true
+			}
+		}
+		scores[i] = float64(len(found)) / float64(len(queryTerms))
+	}
+	return scores, nil
+}
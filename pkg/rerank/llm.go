@@ -0,0 +1,92 @@
+package rerank
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/avivnoah/documentation-assistant/prompt"
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/prompts"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// defaultConcurrency is the number of documents an LLM reranker rates at once
+const defaultConcurrency = 4
+
+// ratingPattern finds the rating in the model's reply
+var ratingPattern = regexp.MustCompile(`\d+(?:\.\d+)?`)
+
+// LLM asks a chat model to rate every document from 0 to 10 with
+// prompt.RERANK_PROMPT, and scores it with the rating divided by 10. Replies
+// without a rating score 0.
+type LLM struct {
+	chain       chains.Chain
+	Concurrency int // Documents rated at once; zero uses 4
+}
+
+var _ Reranker = (*LLM)(nil)
+
+// NewLLM creates a reranker that rates documents with llm
+func NewLLM(llm llms.Model) *LLM {
+	template := prompts.NewPromptTemplate(prompt.RERANK_PROMPT, prompt.RerankVariables)
+	return &LLM{chain: chains.NewLLMChain(llm, template)}
+}
+
+func (r *LLM) Score(ctx context.Context, query string, docs []schema.Document) ([]float64, error) {
+	concurrency := r.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	scores := make([]float64, len(docs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	for i, doc := range docs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errOnce.Do(func() { firstErr = ctx.Err() })
+				return
+			}
+
+			reply, err := chains.Predict(ctx, r.chain, map[string]any{
+				"question": query,
+				"document": doc.PageContent,
+			}, chains.WithTemperature(0))
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			scores[i] = parseRating(reply)
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return scores, nil
+}
+
+// parseRating returns the first number of reply as a score from 0 to 1
+func parseRating(reply string) float64 {
+	rating, err := strconv.ParseFloat(ratingPattern.FindString(reply), 64)
+	if err != nil {
+		return 0
+	}
+	return min(max(rating, 0), 10) / 10
+}
@@ -0,0 +1,51 @@
+// Package rerank re-scores retrieved chunks against the question, so the
+// prompt is filled with the most relevant of a larger set of candidates.
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// ScoreKey is the chunk metadata holding the score given by a Reranker.
+// The chunk's Score keeps the retrieval score.
+const ScoreKey = "rerank_score"
+
+// Reranker scores how relevant documents are to a query
+type Reranker interface {
+	// Score returns one score per document, higher meaning more relevant
+	Score(ctx context.Context, query string, docs []schema.Document) ([]float64, error)
+}
+
+// Rerank scores docs with r and returns the n best, highest first, with their
+// score stored under ScoreKey. Documents with equal scores keep their order.
+func Rerank(ctx context.Context, r Reranker, query string, docs []schema.Document, n int) ([]schema.Document, error) {
+	scores, err := r.Score(ctx, query, docs)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) != len(docs) {
+		return nil, fmt.Errorf("reranker returned %d scores for %d documents", len(scores), len(docs))
+	}
+
+	ranked := make([]schema.Document, 0, len(docs))
+	for i, doc := range docs {
+		metadata := make(map[string]any, len(doc.Metadata)+1)
+		for k, v := range doc.Metadata {
+			metadata[k] = v
+		}
+		metadata[ScoreKey] = scores[i]
+		doc.Metadata = metadata
+		ranked = append(ranked, doc)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Metadata[ScoreKey].(float64) > ranked[j].Metadata[ScoreKey].(float64)
+	})
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked, nil
+}
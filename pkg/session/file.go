@@ -0,0 +1,118 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// validID matches the IDs generated by newSession, so a requested ID can
+// never name a file outside the store's directory
+var validID = regexp.MustCompile(`^[a-z2-7]{1,64}$`)
+
+// File is a Store that writes every session to its own JSON file in a
+// directory, so sessions survive restarts.
+type File struct {
+	mu  sync.Mutex
+	dir string
+}
+
+var _ Store = (*File)(nil)
+
+// NewFile creates a store in dir, creating the directory if needed
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return &File{dir: dir}, nil
+}
+
+func (f *File) Create(_ context.Context) (Session, error) {
+	s := newSession()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return s, f.write(s)
+}
+
+func (f *File) Get(_ context.Context, id string) (Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.read(id)
+}
+
+func (f *File) Append(_ context.Context, id string, turns ...Turn) (Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, err := f.read(id)
+	if err != nil {
+		return Session{}, err
+	}
+	appendTurns(&s, turns)
+	return s, f.write(s)
+}
+
+func (f *File) SetSummary(_ context.Context, id, summary string, turns int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, err := f.read(id)
+	if err != nil {
+		return err
+	}
+	s.Summary, s.SummarizedTurns = summary, turns
+	return f.write(s)
+}
+
+func (f *File) Delete(_ context.Context, id string) error {
+	if !validID.MatchString(id) {
+		return ErrNotFound
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := os.Remove(f.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (f *File) path(id string) string {
+	return filepath.Join(f.dir, id+".json")
+}
+
+// read loads a session. The caller must hold f.mu.
+func (f *File) read(id string) (Session, error) {
+	if !validID.MatchString(id) {
+		return Session{}, ErrNotFound
+	}
+	data, err := os.ReadFile(f.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Session{}, ErrNotFound
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Session{}, fmt.Errorf("failed to parse session %s: %w", id, err)
+	}
+	return s, nil
+}
+
+// write atomically replaces the session's file. The caller must hold f.mu.
+func (f *File) write(s Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := f.path(s.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path(s.ID))
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Memory is a Store that keeps sessions in process memory. Sessions are lost
+// when the server restarts.
+type Memory struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{sessions: map[string]Session{}}
+}
+
+func (m *Memory) Create(_ context.Context) (Session, error) {
+	s := newSession()
+	m.mu.Lock()
+	m.sessions[s.ID] = s
+	m.mu.Unlock()
+	return s, nil
+}
+
+func (m *Memory) Get(_ context.Context, id string) (Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	s.Turns = slices.Clone(s.Turns)
+	return s, nil
+}
+
+func (m *Memory) Append(_ context.Context, id string, turns ...Turn) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	s.Turns = slices.Clone(s.Turns)
+	appendTurns(&s, turns)
+	m.sessions[id] = s
+	return s, nil
+}
+
+func (m *Memory) SetSummary(_ context.Context, id, summary string, turns int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	s.Summary, s.SummarizedTurns = summary, turns
+	m.sessions[id] = s
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.sessions, id)
+	return nil
+}
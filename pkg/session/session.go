@@ -0,0 +1,87 @@
+// Package session stores the transcripts of server-side chat sessions so
+// clients can hold a multi-turn conversation by ID instead of resending the
+// whole history with every query.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Roles of a Turn, matching the roles accepted in a query's chat_history
+const (
+	RoleHuman = "human"
+	RoleAI    = "ai"
+)
+
+// ErrNotFound is returned for unknown or deleted session IDs
+var ErrNotFound = errors.New("session not found")
+
+// Turn is one message of a conversation
+type Turn struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Session is a conversation transcript
+type Session struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Turns     []Turn    `json:"turns"`
+
+	// Summary condenses the first SummarizedTurns turns, so long
+	// conversations do not have to be summarized again on every query
+	Summary         string `json:"summary,omitempty"`
+	SummarizedTurns int    `json:"summarized_turns,omitempty"`
+}
+
+// History returns the transcript as [role, content] pairs
+func (s Session) History() [][]string {
+	history := make([][]string, 0, len(s.Turns))
+	for _, t := range s.Turns {
+		history = append(history, []string{t.Role, t.Content})
+	}
+	return history
+}
+
+// Store keeps sessions. Implementations must be safe for concurrent use.
+type Store interface {
+	// Create starts an empty session with a new ID
+	Create(ctx context.Context) (Session, error)
+	// Get returns the session with id, or ErrNotFound
+	Get(ctx context.Context, id string) (Session, error)
+	// Append adds turns to the end of the session's transcript
+	Append(ctx context.Context, id string, turns ...Turn) (Session, error)
+	// SetSummary records the running summary of the session's first turns
+	SetSummary(ctx context.Context, id, summary string, turns int) error
+	// Delete removes the session, or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+}
+
+// newSession returns an empty session with a random ID
+func newSession() Session {
+	now := time.Now()
+	return Session{
+		ID:        strings.ToLower(rand.Text()),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Turns:     []Turn{},
+	}
+}
+
+// appendTurns adds turns to s, stamping those without a time
+func appendTurns(s *Session, turns []Turn) {
+	now := time.Now()
+	for _, t := range turns {
+		if t.CreatedAt.IsZero() {
+			t.CreatedAt = now
+		}
+		s.Turns = append(s.Turns, t)
+	}
+	s.UpdatedAt = now
+}
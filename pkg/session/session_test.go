@@ -0,0 +1,132 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(*testing.T) Store { return NewMemory() },
+		"file": func(t *testing.T) Store {
+			f, err := NewFile(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return f
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+
+			s, err := store.Create(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !validID.MatchString(s.ID) {
+				t.Errorf("new session ID %q does not match %s", s.ID, validID)
+			}
+
+			if _, err := store.Append(ctx, s.ID, Turn{Role: RoleHuman, Content: "hi"}, Turn{Role: RoleAI, Content: "hello"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SetSummary(ctx, s.ID, "greetings", 2); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Append(ctx, s.ID, Turn{Role: RoleHuman, Content: "bye"}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := store.Get(ctx, s.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Turns) != 3 || got.Turns[2].Content != "bye" || got.Turns[0].CreatedAt.IsZero() {
+				t.Errorf("turns = %+v, want the three appended turns with times", got.Turns)
+			}
+			if got.Summary != "greetings" || got.SummarizedTurns != 2 {
+				t.Errorf("summary = %q of %d turns, want \"greetings\" of 2", got.Summary, got.SummarizedTurns)
+			}
+
+			if err := store.Delete(ctx, s.ID); err != nil {
+				t.Fatal(err)
+			}
+			for op, err := range map[string]error{
+				"Get":        func() error { _, err := store.Get(ctx, s.ID); return err }(),
+				"Append":     func() error { _, err := store.Append(ctx, s.ID, Turn{}); return err }(),
+				"SetSummary": store.SetSummary(ctx, s.ID, "", 0),
+				"Delete":     store.Delete(ctx, s.ID),
+			} {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("%s of a deleted session = %v, want ErrNotFound", op, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFilePersistsSessions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := f.Create(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Append(ctx, s.ID, Turn{Role: RoleHuman, Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetSummary(ctx, s.ID, "a greeting", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Get(ctx, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Turns) != 1 || got.Turns[0].Content != "hi" || got.Summary != "a greeting" || got.SummarizedTurns != 1 {
+		t.Errorf("reopened session = %+v, want its turn and summary", got)
+	}
+}
+
+func TestFileRejectsInvalidIDs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := NewFile(filepath.Join(dir, "sessions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A file next to the store that a path traversal would reach
+	outside := filepath.Join(dir, "secret.json")
+	if err := os.WriteFile(outside, []byte(`{"id": "secret", "turns": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"", "../secret", "ABC", "abc1", "abc.json", strings.Repeat("a", 65)} {
+		if _, err := f.Get(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want ErrNotFound", id, err)
+		}
+		if _, err := f.Append(ctx, id, Turn{Role: RoleHuman}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Append(%q) = %v, want ErrNotFound", id, err)
+		}
+		if err := f.Delete(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete(%q) = %v, want ErrNotFound", id, err)
+		}
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("the file outside the store was touched: %v", err)
+	}
+}
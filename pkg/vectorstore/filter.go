@@ -0,0 +1,149 @@
+package vectorstore
+
+import (
+	"reflect"
+	"slices"
+)
+
+// MatchFilter reports whether metadata satisfies filter, a metadata filter in
+// Pinecone's syntax, so every backend gives a filter the same meaning:
+//
+//   - {"key": value} and {"key": {"$eq": value}} match equal values;
+//   - "$ne", "$in", "$nin", "$gt", "$gte", "$lt", "$lte" and "$exists"
+//     compare the value with an operand;
+//   - {"$and": [...]} and {"$or": [...]} combine filters;
+//   - several keys in one filter must all match.
+//
+// A list value, such as tags, matches "$eq" and "$in" when any of its elements
+// does, and "$ne" and "$nin" when none does. Numbers compare as float64 so
+// values survive a round trip through JSON. An empty filter matches everything.
+func MatchFilter(metadata, filter map[string]any) bool {
+	for key, condition := range filter {
+		switch key {
+		case "$and":
+			for _, sub := range subFilters(condition) {
+				if !MatchFilter(metadata, sub) {
+					return false
+				}
+			}
+		case "$or":
+			subs := subFilters(condition)
+			if !slices.ContainsFunc(subs, func(sub map[string]any) bool { return MatchFilter(metadata, sub) }) {
+				return false
+			}
+		default:
+			value, exists := metadata[key]
+			operators, ok := condition.(map[string]any)
+			if !ok {
+				operators = map[string]any{"$eq": condition}
+			}
+			for op, operand := range operators {
+				if !matchOperator(op, value, exists, operand) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// subFilters returns the filters combined by $and or $or
+func subFilters(condition any) []map[string]any {
+	var subs []map[string]any
+	switch c := condition.(type) {
+	case []map[string]any:
+		subs = c
+	case []any:
+		for _, sub := range c {
+			if m, ok := sub.(map[string]any); ok {
+				subs = append(subs, m)
+			}
+		}
+	}
+	return subs
+}
+
+// matchOperator applies one comparison operator to a metadata value
+func matchOperator(op string, value any, exists bool, operand any) bool {
+	switch op {
+	case "$exists":
+		want, _ := operand.(bool)
+		return exists == want
+	case "$eq":
+		return exists && anyElement(value, func(v any) bool { return valuesEqual(v, operand) })
+	case "$ne":
+		return !exists || !anyElement(value, func(v any) bool { return valuesEqual(v, operand) })
+	case "$in":
+		return exists && anyElement(value, func(v any) bool { return inList(v, operand) })
+	case "$nin":
+		return !exists || !anyElement(value, func(v any) bool { return inList(v, operand) })
+	case "$gt", "$gte", "$lt", "$lte":
+		a, ok := toFloat(value)
+		b, ok2 := toFloat(operand)
+		if !exists || !ok || !ok2 {
+			return false
+		}
+		switch op {
+		case "$gt":
+			return a > b
+		case "$gte":
+			return a >= b
+		case "$lt":
+			return a < b
+		default:
+			return a <= b
+		}
+	}
+	return false
+}
+
+// anyElement applies match to value, or to each element when value is a list
+func anyElement(value any, match func(any) bool) bool {
+	switch list := value.(type) {
+	case []any:
+		return slices.ContainsFunc(list, match)
+	case []string:
+		return slices.ContainsFunc(list, func(s string) bool { return match(s) })
+	}
+	return match(value)
+}
+
+// inList reports whether value equals an element of list
+func inList(value, list any) bool {
+	switch l := list.(type) {
+	case []any:
+		return slices.ContainsFunc(l, func(v any) bool { return valuesEqual(value, v) })
+	case []string:
+		return slices.ContainsFunc(l, func(v string) bool { return valuesEqual(value, v) })
+	}
+	return false
+}
+
+// valuesEqual compares metadata values, treating all numeric types as float64
+// so values survive a round trip through JSON.
+func valuesEqual(a, b any) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	if a == nil || b == nil || !reflect.TypeOf(a).Comparable() {
+		return a == nil && b == nil
+	}
+	return a == b
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
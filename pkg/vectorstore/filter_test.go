@@ -0,0 +1,57 @@
+package vectorstore
+
+import "testing"
+
+func TestMatchFilter(t *testing.T) {
+	metadata := map[string]any{
+		"host":        "docs.example.com",
+		"tags":        []any{"api", "v2"},
+		"ingested_at": float64(1700000000), // As decoded from JSON
+	}
+
+	tests := []struct {
+		name   string
+		filter map[string]any
+		want   bool
+	}{
+		{"empty", nil, true},
+		{"implicit eq", map[string]any{"host": "docs.example.com"}, true},
+		{"eq", map[string]any{"host": map[string]any{"$eq": "docs.example.com"}}, true},
+		{"eq mismatch", map[string]any{"host": map[string]any{"$eq": "example.org"}}, false},
+		{"eq missing key", map[string]any{"lang": map[string]any{"$eq": "go"}}, false},
+		{"eq list element", map[string]any{"tags": "v2"}, true},
+		{"eq number across types", map[string]any{"ingested_at": 1700000000}, true},
+		{"in", map[string]any{"host": map[string]any{"$in": []any{"example.org", "docs.example.com"}}}, true},
+		{"in strings", map[string]any{"host": map[string]any{"$in": []string{"example.org"}}}, false},
+		{"in list element", map[string]any{"tags": map[string]any{"$in": []any{"v1", "api"}}}, true},
+		{"in no element", map[string]any{"tags": map[string]any{"$in": []any{"v1"}}}, false},
+		{"and", map[string]any{"$and": []any{
+			map[string]any{"host": "docs.example.com"},
+			map[string]any{"ingested_at": map[string]any{"$gte": 1600000000}},
+		}}, true},
+		{"and one fails", map[string]any{"$and": []map[string]any{
+			{"host": "docs.example.com"},
+			{"tags": "v1"},
+		}}, false},
+		{"or", map[string]any{"$or": []any{
+			map[string]any{"host": "example.org"},
+			map[string]any{"tags": "api"},
+		}}, true},
+		{"or none", map[string]any{"$or": []any{
+			map[string]any{"host": "example.org"},
+			map[string]any{"tags": "v1"},
+		}}, false},
+		{"or inside and", map[string]any{"$and": []any{
+			map[string]any{"$or": []any{map[string]any{"tags": "v1"}, map[string]any{"tags": "v2"}}},
+			map[string]any{"host": map[string]any{"$in": []any{"docs.example.com"}}},
+		}}, true},
+		{"keys combine with and", map[string]any{"host": "docs.example.com", "tags": "v1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchFilter(metadata, tt.filter); got != tt.want {
+				t.Errorf("MatchFilter(%v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
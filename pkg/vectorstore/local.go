@@ -0,0 +1,99 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// Local is a Memory store that persists its documents to a JSON file after
+// every change and reloads them on startup.
+type Local struct {
+	*Memory
+	path   string
+	saveMu sync.Mutex
+}
+
+var _ Store = (*Local)(nil)
+
+// localFile is the on-disk layout of a Local store
+type localFile struct {
+	Entries []entry `json:"entries"`
+}
+
+// NewLocal opens the store saved at path, creating an empty one if the file
+// does not exist yet.
+func NewLocal(path string, embedder embeddings.Embedder) (*Local, error) {
+	l := &Local{Memory: NewMemory(embedder), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local vector store: %w", err)
+	}
+
+	var file localFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse local vector store %s: %w", path, err)
+	}
+	l.entries = file.Entries
+	return l, nil
+}
+
+// AddDocuments stores the documents and writes the store to disk.
+func (l *Local) AddDocuments(ctx context.Context, docs []schema.Document, options ...vectorstores.Option) ([]string, error) {
+	ids, err := l.Memory.AddDocuments(ctx, docs, options...)
+	if err != nil {
+		return nil, err
+	}
+	return ids, l.save()
+}
+
+// Delete removes matching documents and writes the store to disk.
+func (l *Local) Delete(ctx context.Context, filter map[string]any) (int, error) {
+	deleted, err := l.Memory.Delete(ctx, filter)
+	if err != nil || deleted == 0 {
+		return deleted, err
+	}
+	return deleted, l.save()
+}
+
+// DeleteIDs removes the documents with the given IDs and writes the store to disk.
+func (l *Local) DeleteIDs(_ context.Context, ids []string) error {
+	if l.Memory.deleteIDs(ids) == 0 {
+		return nil
+	}
+	return l.save()
+}
+
+// save atomically replaces the file at l.path with the current entries
+func (l *Local) save() error {
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+
+	l.mu.RLock()
+	data, err := json.Marshal(localFile{Entries: l.entries})
+	l.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
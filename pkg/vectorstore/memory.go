@@ -0,0 +1,232 @@
+package vectorstore
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// ErrEmbedderWrongNumberVectors is returned when the embedder does not return
+// one vector per document.
+var ErrEmbedderWrongNumberVectors = errors.New("number of vectors from embedder does not match number of documents")
+
+// entry is a single stored document together with its embedding
+type entry struct {
+	ID       string         `json:"id"`
+	Content  string         `json:"content"`
+	Metadata map[string]any `json:"metadata"`
+	Vector   []float32      `json:"vector"`
+}
+
+// Memory is a Store that keeps every document in process memory and answers
+// similarity searches with a brute-force cosine similarity scan. It is meant
+// for local development and tests, not for large corpora.
+type Memory struct {
+	mu       sync.RWMutex
+	embedder embeddings.Embedder
+	entries  []entry
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory creates an empty in-memory store that embeds documents with embedder.
+func NewMemory(embedder embeddings.Embedder) *Memory {
+	return &Memory{embedder: embedder}
+}
+
+// AddDocuments embeds the documents and stores them, returning their IDs.
+// Documents whose ID is already stored replace the stored document.
+func (m *Memory) AddDocuments(ctx context.Context, docs []schema.Document, options ...vectorstores.Option) ([]string, error) {
+	opts := m.getOptions(options...)
+
+	texts := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		texts = append(texts, doc.PageContent)
+	}
+
+	vectors, err := opts.Embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(docs) {
+		return nil, ErrEmbedderWrongNumberVectors
+	}
+
+	added := make([]entry, 0, len(docs))
+	ids := make([]string, 0, len(docs))
+	for i, doc := range docs {
+		if opts.Deduplicater != nil && opts.Deduplicater(ctx, doc) {
+			continue
+		}
+		e := entry{
+			ID:       documentID(doc),
+			Content:  doc.PageContent,
+			Metadata: copyMetadata(doc.Metadata),
+			Vector:   vectors[i],
+		}
+		added = append(added, e)
+		ids = append(ids, e.ID)
+	}
+
+	m.mu.Lock()
+	index := make(map[string]int, len(m.entries))
+	for i, e := range m.entries {
+		index[e.ID] = i
+	}
+	for _, e := range added {
+		if i, ok := index[e.ID]; ok {
+			m.entries[i] = e
+			continue
+		}
+		index[e.ID] = len(m.entries)
+		m.entries = append(m.entries, e)
+	}
+	m.mu.Unlock()
+
+	return ids, nil
+}
+
+// SimilaritySearch returns the numDocuments documents most similar to query.
+// Filters given with vectorstores.WithFilters must be a map[string]any and are
+// matched against document metadata.
+func (m *Memory) SimilaritySearch(ctx context.Context, query string, numDocuments int, options ...vectorstores.Option) ([]schema.Document, error) {
+	opts := m.getOptions(options...)
+
+	filter, err := filterFromOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	queryVector, err := opts.Embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	docs := make([]schema.Document, 0, len(m.entries))
+	for _, e := range m.entries {
+		if !MatchFilter(e.Metadata, filter) {
+			continue
+		}
+		score := cosineSimilarity(queryVector, e.Vector)
+		if opts.ScoreThreshold > 0 && score < opts.ScoreThreshold {
+			continue
+		}
+		docs = append(docs, schema.Document{
+			PageContent: e.Content,
+			Metadata:    copyMetadata(e.Metadata),
+			Score:       score,
+		})
+	}
+	m.mu.RUnlock()
+
+	sort.SliceStable(docs, func(i, j int) bool { return docs[i].Score > docs[j].Score })
+	if numDocuments >= 0 && len(docs) > numDocuments {
+		docs = docs[:numDocuments]
+	}
+	return docs, nil
+}
+
+// Delete removes every document whose metadata matches filter.
+func (m *Memory) Delete(_ context.Context, filter map[string]any) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.entries[:0]
+	for _, e := range m.entries {
+		if !MatchFilter(e.Metadata, filter) {
+			kept = append(kept, e)
+		}
+	}
+	deleted := len(m.entries) - len(kept)
+	clear(m.entries[len(kept):])
+	m.entries = kept
+	return deleted, nil
+}
+
+// DeleteIDs removes the documents with the given IDs.
+func (m *Memory) DeleteIDs(_ context.Context, ids []string) error {
+	m.deleteIDs(ids)
+	return nil
+}
+
+// deleteIDs removes the documents with the given IDs and returns how many were found
+func (m *Memory) deleteIDs(ids []string) int {
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.entries[:0]
+	for _, e := range m.entries {
+		if !remove[e.ID] {
+			kept = append(kept, e)
+		}
+	}
+	deleted := len(m.entries) - len(kept)
+	clear(m.entries[len(kept):])
+	m.entries = kept
+	return deleted
+}
+
+func (m *Memory) getOptions(options ...vectorstores.Option) vectorstores.Options {
+	opts := vectorstores.Options{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if opts.Embedder == nil {
+		opts.Embedder = m.embedder
+	}
+	return opts
+}
+
+// filterFromOptions extracts the metadata filter passed with vectorstores.WithFilters
+func filterFromOptions(opts vectorstores.Options) (map[string]any, error) {
+	if opts.Filters == nil {
+		return nil, nil
+	}
+	filter, ok := opts.Filters.(map[string]any)
+	if !ok {
+		return nil, errors.New("filters must be a map[string]any")
+	}
+	return filter, nil
+}
+
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
+
+func copyMetadata(metadata map[string]any) map[string]any {
+	out := make(map[string]any, len(metadata))
+	for k, v := range metadata {
+		out[k] = v
+	}
+	return out
+}
+
+// newID returns a random document identifier
+func newID() string {
+	return strings.ToLower(rand.Text())
+}
@@ -0,0 +1,140 @@
+package vectorstore
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// wordEmbedder embeds a text as the counts of a fixed vocabulary, so texts
+// sharing words are similar
+type wordEmbedder struct{}
+
+var vocabulary = []string{"install", "linux", "windows", "query", "api"}
+
+func (wordEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i], _ = wordEmbedder{}.EmbedQuery(ctx, text)
+	}
+	return vectors, nil
+}
+
+func (wordEmbedder) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	vector := make([]float32, len(vocabulary))
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		for i, known := range vocabulary {
+			if word == known {
+				vector[i]++
+			}
+		}
+	}
+	return vector, nil
+}
+
+var testDocuments = []schema.Document{
+	{PageContent: "install on linux", Metadata: map[string]any{ChunkIDKey: "a", "source": "https://example.com/linux"}},
+	{PageContent: "install on windows", Metadata: map[string]any{ChunkIDKey: "b", "source": "https://example.com/windows"}},
+	{PageContent: "query api", Metadata: map[string]any{ChunkIDKey: "c", "source": "https://example.com/api"}},
+}
+
+func sources(docs []schema.Document) []string {
+	var out []string
+	for _, doc := range docs {
+		out = append(out, doc.Metadata["source"].(string))
+	}
+	return out
+}
+
+func TestMemoryAddSearchDelete(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory(wordEmbedder{})
+
+	ids, err := store.AddDocuments(ctx, testDocuments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "a,b,c" {
+		t.Fatalf("ids = %v, want the chunk IDs", ids)
+	}
+	// Adding a document with a stored ID replaces it
+	if _, err := store.AddDocuments(ctx, testDocuments[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	docs, err := store.SimilaritySearch(ctx, "linux install", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sources(docs); len(got) != 2 || got[0] != "https://example.com/linux" {
+		t.Fatalf("search returned %v, want the linux page first", got)
+	}
+
+	docs, err = store.SimilaritySearch(ctx, "install", 5, vectorstores.WithFilters(map[string]any{"source": "https://example.com/windows"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sources(docs); len(got) != 1 || got[0] != "https://example.com/windows" {
+		t.Fatalf("filtered search returned %v", got)
+	}
+
+	if err := store.DeleteIDs(ctx, []string{"a", "unknown"}); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := store.Delete(ctx, map[string]any{"source": "https://example.com/api"})
+	if err != nil || deleted != 1 {
+		t.Fatalf("Delete = %d, %v, want 1 document", deleted, err)
+	}
+	docs, _ = store.SimilaritySearch(ctx, "install", 5)
+	if got := sources(docs); len(got) != 1 || got[0] != "https://example.com/windows" {
+		t.Fatalf("after deletes the store holds %v", got)
+	}
+
+	deleted, _ = store.Delete(ctx, nil)
+	if deleted != 1 {
+		t.Fatalf("deleting everything removed %d documents, want 1", deleted)
+	}
+}
+
+func TestLocalPersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	store, err := NewLocal(path, wordEmbedder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AddDocuments(ctx, testDocuments); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteIDs(ctx, []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewLocal(path, wordEmbedder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := reopened.SimilaritySearch(ctx, "install api", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sources(docs); len(got) != 2 {
+		t.Fatalf("reopened store holds %v, want the 2 documents left", got)
+	}
+
+	if _, err := reopened.Delete(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err = NewLocal(path, wordEmbedder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if docs, _ := reopened.SimilaritySearch(ctx, "install", 5); len(docs) != 0 {
+		t.Fatalf("store still holds %d documents after deleting everything", len(docs))
+	}
+}
@@ -0,0 +1,200 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	gopinecone "github.com/pinecone-io/go-pinecone/pinecone"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+	"github.com/tmc/langchaingo/vectorstores/pinecone"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Pinecone is a Store backed by a single namespace of a Pinecone index.
+type Pinecone struct {
+	pinecone.Store
+
+	embedder  embeddings.Embedder
+	client    *gopinecone.Client
+	host      string
+	namespace string
+}
+
+var _ Store = (*Pinecone)(nil)
+
+// NewPinecone connects to the index at host and scopes every operation to
+// namespace. The API key is read from PINECONE_API_KEY.
+func NewPinecone(host, namespace string, embedder embeddings.Embedder) (*Pinecone, error) {
+	store, err := pinecone.New(
+		pinecone.WithHost(host),
+		pinecone.WithEmbedder(embedder),
+		pinecone.WithNameSpace(namespace),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := gopinecone.NewClient(gopinecone.NewClientParams{ApiKey: os.Getenv("PINECONE_API_KEY")})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Pinecone client: %w", err)
+	}
+
+	return &Pinecone{
+		Store:     store,
+		embedder:  embedder,
+		client:    client,
+		host:      strings.TrimPrefix(host, "https://"),
+		namespace: namespace,
+	}, nil
+}
+
+// pineconeTextKey is the metadata key langchaingo's Pinecone store reads page content from
+const pineconeTextKey = "text"
+
+// maxDeleteIDs is the largest number of IDs Pinecone accepts in one delete request
+const maxDeleteIDs = 1000
+
+// AddDocuments embeds the documents and upserts them into the namespace. It
+// replaces langchaingo's implementation, which always assigns random IDs, so
+// that documents carrying ChunkIDKey metadata overwrite their previous version.
+func (p *Pinecone) AddDocuments(ctx context.Context, docs []schema.Document, options ...vectorstores.Option) ([]string, error) {
+	opts := vectorstores.Options{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	embedder := p.embedder
+	if opts.Embedder != nil {
+		embedder = opts.Embedder
+	}
+
+	if opts.Deduplicater != nil {
+		kept := make([]schema.Document, 0, len(docs))
+		for _, doc := range docs {
+			if !opts.Deduplicater(ctx, doc) {
+				kept = append(kept, doc)
+			}
+		}
+		docs = kept
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	texts := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		texts = append(texts, doc.PageContent)
+	}
+	vectors, err := embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(docs) {
+		return nil, ErrEmbedderWrongNumberVectors
+	}
+
+	namespace := p.namespace
+	if opts.NameSpace != "" {
+		namespace = opts.NameSpace
+	}
+	conn, err := p.client.IndexWithNamespace(p.host, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ids := make([]string, 0, len(docs))
+	pineconeVectors := make([]*gopinecone.Vector, 0, len(docs))
+	for i, doc := range docs {
+		metadata := copyMetadata(doc.Metadata)
+		metadata[pineconeTextKey] = doc.PageContent
+		metadataStruct, err := structpb.NewStruct(metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		id := documentID(doc)
+		ids = append(ids, id)
+		pineconeVectors = append(pineconeVectors, &gopinecone.Vector{
+			Id:       id,
+			Values:   vectors[i],
+			Metadata: metadataStruct,
+		})
+	}
+
+	if _, err := conn.UpsertVectors(&ctx, pineconeVectors); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// DeleteIDs removes the vectors with the given IDs from the namespace.
+func (p *Pinecone) DeleteIDs(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	conn, err := p.client.IndexWithNamespace(p.host, p.namespace)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for start := 0; start < len(ids); start += maxDeleteIDs {
+		end := min(start+maxDeleteIDs, len(ids))
+		if err := conn.DeleteVectorsById(&ctx, ids[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dimension returns the dimension of the index's vectors, which every
+// embedding stored in it must have
+func (p *Pinecone) Dimension(ctx context.Context) (int, error) {
+	conn, err := p.client.IndexWithNamespace(p.host, p.namespace)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	stats, err := conn.DescribeIndexStats(&ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to describe index: %w", err)
+	}
+	return int(stats.Dimension), nil
+}
+
+// Delete removes every vector of the namespace and returns how many there
+// were, from the index statistics taken just before the delete is issued.
+// Serverless indexes reject deletes and statistics filtered by metadata, so a
+// non-empty filter returns ErrFilteredDelete; delete by ID with DeleteIDs instead.
+func (p *Pinecone) Delete(ctx context.Context, filter map[string]any) (int, error) {
+	if len(filter) > 0 {
+		return 0, ErrFilteredDelete
+	}
+	conn, err := p.client.IndexWithNamespace(p.host, p.namespace)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	stats, err := conn.DescribeIndexStats(&ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to describe index: %w", err)
+	}
+	count := 0
+	if ns, ok := stats.Namespaces[p.namespace]; ok && ns != nil {
+		count = int(ns.VectorCount)
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	if err := conn.DeleteAllVectorsInNamespace(&ctx); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
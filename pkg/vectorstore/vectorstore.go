@@ -0,0 +1,44 @@
+// Package vectorstore wraps the langchaingo vector stores used by the
+// documentation assistant with the management operations the server needs
+// on top of adding and searching documents.
+package vectorstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// ChunkIDKey is the metadata key holding a caller-chosen document ID. Every
+// Store uses it as the ID of the stored document, so adding a document with
+// the ID of an existing one replaces it instead of creating a duplicate.
+const ChunkIDKey = "chunk_id"
+
+// ErrFilteredDelete is returned by Store.Delete when the store cannot delete
+// documents by metadata filter
+var ErrFilteredDelete = errors.New("the vector store cannot delete by metadata filter, delete by ID instead")
+
+// Store is a vector store that can also remove documents.
+type Store interface {
+	vectorstores.VectorStore
+
+	// Delete removes the documents whose metadata matches every key/value
+	// pair in filter, or every document when filter is empty, and returns
+	// the number of documents removed. Stores that cannot filter deletes
+	// return ErrFilteredDelete for a non-empty filter.
+	Delete(ctx context.Context, filter map[string]any) (int, error)
+
+	// DeleteIDs removes the documents with the given IDs. Unknown IDs are ignored.
+	DeleteIDs(ctx context.Context, ids []string) error
+}
+
+// documentID returns the ID a document is stored under: its ChunkIDKey
+// metadata when set, otherwise a new random ID.
+func documentID(doc schema.Document) string {
+	if id, ok := doc.Metadata[ChunkIDKey].(string); ok && id != "" {
+		return id
+	}
+	return newID()
+}
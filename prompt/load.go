@@ -0,0 +1,119 @@
+package prompt
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Variables each template must use
+var (
+	RAGVariables      = []string{"context", "question", "chat_history"}
+	RephraseVariables = []string{"chat_history", "question"}
+	SummaryVariables  = []string{"summary", "new_lines"}
+	RerankVariables   = []string{"question", "document"}
+)
+
+// Load returns the template stored in path, or fallback when path is empty.
+// The template must be a Go template using exactly the given variables.
+func Load(path, fallback string, variables []string) (string, error) {
+	if path == "" {
+		return fallback, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt template: %w", err)
+	}
+	text := string(data)
+	if err := Validate(text, variables); err != nil {
+		return "", fmt.Errorf("invalid prompt template %s: %w", path, err)
+	}
+	return text, nil
+}
+
+// Validate checks that text parses as a Go template, uses every one of
+// variables and no other variable.
+func Validate(text string, variables []string) error {
+	tmpl, err := template.New("prompt").Parse(text)
+	if err != nil {
+		return err
+	}
+
+	used := map[string]bool{}
+	if tmpl.Tree != nil {
+		collectFields(tmpl.Tree.Root, used)
+	}
+
+	var missing, unknown []string
+	for _, v := range variables {
+		if !used[v] {
+			missing = append(missing, v)
+		}
+	}
+	for v := range used {
+		if !slices.Contains(variables, v) {
+			unknown = append(unknown, v)
+		}
+	}
+	slices.Sort(unknown)
+
+	switch {
+	case len(missing) > 0:
+		return fmt.Errorf("missing variables %s", formatVariables(missing))
+	case len(unknown) > 0:
+		return fmt.Errorf("unknown variables %s; available: %s", formatVariables(unknown), formatVariables(variables))
+	}
+	return nil
+}
+
+// collectFields records the top-level field names, {{.name}}, used below node
+func collectFields(node parse.Node, used map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, used)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, used)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, used)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, used)
+		}
+	case *parse.FieldNode:
+		used[n.Ident[0]] = true
+	case *parse.IfNode:
+		collectFields(n.Pipe, used)
+		collectFields(n.List, used)
+		collectFields(n.ElseList, used)
+	case *parse.RangeNode:
+		collectFields(n.Pipe, used)
+		collectFields(n.List, used)
+		collectFields(n.ElseList, used)
+	case *parse.WithNode:
+		collectFields(n.Pipe, used)
+		collectFields(n.List, used)
+		collectFields(n.ElseList, used)
+	}
+}
+
+func formatVariables(variables []string) string {
+	quoted := make([]string, 0, len(variables))
+	for _, v := range variables {
+		quoted = append(quoted, "{{."+v+"}}")
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,81 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string // Empty when the template is valid
+	}{
+		{"every variable", "{{.question}} {{.chat_history}}", ""},
+		{"variables in actions", "{{if .chat_history}}{{.chat_history}}{{end}}{{with .question}}{{.}}{{end}}", ""},
+		{"missing variable", "{{.question}}", "missing variables {{.chat_history}}"},
+		{"unknown variable", "{{.question}} {{.chat_history}} {{.history}}", "unknown variables {{.history}}"},
+		{"syntax error", "{{.question}} {{.chat_history", "unclosed action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.text, RephraseVariables)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate failed: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultTemplatesAreValid(t *testing.T) {
+	for name, tmpl := range map[string]struct {
+		text      string
+		variables []string
+	}{
+		"RAG_PROMPT":      {RAG_PROMPT, RAGVariables},
+		"REPHRASE_PROMPT": {REPHRASE_PROMPT, RephraseVariables},
+		"SUMMARY_PROMPT":  {SUMMARY_PROMPT, SummaryVariables},
+		"RERANK_PROMPT":   {RERANK_PROMPT, RerankVariables},
+	} {
+		if err := Validate(tmpl.text, tmpl.variables); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	text, err := Load("", REPHRASE_PROMPT, RephraseVariables)
+	if err != nil || text != REPHRASE_PROMPT {
+		t.Errorf("empty path = %q, %v; want the fallback", text, err)
+	}
+
+	custom := "Rewrite {{.question}} given {{.chat_history}}"
+	if text, err := Load(write("custom.tmpl", custom), REPHRASE_PROMPT, RephraseVariables); err != nil || text != custom {
+		t.Errorf("valid file = %q, %v; want its content", text, err)
+	}
+
+	path := write("missing.tmpl", "Rewrite {{.question}}")
+	if _, err := Load(path, REPHRASE_PROMPT, RephraseVariables); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("template missing a variable = %v, want an error naming the file", err)
+	}
+	if _, err := Load(write("extra.tmpl", custom+" {{.context}}"), REPHRASE_PROMPT, RephraseVariables); err == nil {
+		t.Error("template with an unknown variable was accepted")
+	}
+	if _, err := Load(filepath.Join(dir, "absent.tmpl"), REPHRASE_PROMPT, RephraseVariables); err == nil {
+		t.Error("a missing file was accepted")
+	}
+}
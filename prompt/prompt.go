@@ -1,17 +1,23 @@
 package prompt
 
+// RAG_PROMPT answers a question from the numbered chunks in context. It must
+// use the context, question and chat_history variables.
 const RAG_PROMPT = `
-Answer any use questions based solely on the context below:
+Answer the user's question based solely on the numbered pieces of context below. If you don't know the answer, just say that you don't know, don't try to make up an answer.
+Cite the pieces you used inline with their number in square brackets, separated from the preceding word by a space, for example "statement [1]" or "statement [2, 3]", right after the statement they support. Never put citations inside code. Only cite numbers that appear in the context.
+
 Context:
 {{.context}}
 
-PLACEHOLDER
-chat_history
+Chat History:
+{{.chat_history}}
 
-HUMAN
-{{.question}}
+Question: {{.question}}
+Helpful Answer:
 `
 
+// REPHRASE_PROMPT turns a follow up question into a standalone question used
+// for retrieval. It must use the chat_history and question variables.
 const REPHRASE_PROMPT = `
 Given the following conversation and a follow up question, rephrase the follow up question to be a standalone question.
 
@@ -20,3 +26,30 @@ Chat History:
 Follow Up Input: {{.question}}
 Standalone Question:
 `
+
+// SUMMARY_PROMPT folds older conversation lines into a running summary. It
+// uses the summary and new_lines variables.
+const SUMMARY_PROMPT = `
+Progressively summarize the lines of conversation provided, adding onto the previous summary and returning a new summary. Keep the names of APIs, functions, flags and error messages the user asked about.
+
+Current summary:
+{{.summary}}
+
+New lines of conversation:
+{{.new_lines}}
+
+New summary:
+`
+
+// RERANK_PROMPT asks the model how well a retrieved chunk answers a question.
+// It uses the question and document variables.
+const RERANK_PROMPT = `
+Rate how useful the following documentation excerpt is for answering the question, on a scale from 0 (unrelated) to 10 (answers it directly). Reply with the number only.
+
+Question: {{.question}}
+
+Excerpt:
+{{.document}}
+
+Rating:
+`
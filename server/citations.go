@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// citationPattern matches inline citations such as [1] or [1, 3], with the
+// whitespace before them. Matches inside code or indexing an expression, as in
+// items[0], are not citations; see resolveCitations.
+var citationPattern = regexp.MustCompile(`([ \t]*)\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Citation maps an inline citation of the answer to the chunk it refers to
+type Citation struct {
+	Number int         `json:"number"` // n as written in the answer, [n]
+	Source QuerySource `json:"source"`
+}
+
+// numberedStuffDocuments is a stuff documents chain that labels every chunk
+// with its position, [1] being the first retrieved chunk, so the model can
+// cite chunks inline. The documents returned by the retrieval chain are
+// unchanged, so [n] refers to the n-th source document.
+type numberedStuffDocuments struct {
+	chains.StuffDocuments
+
+	// chatHistory fills the prompt's chat_history variable. The retrieval
+	// chain only passes the question and documents, so runLLM sets it on a
+	// per-request copy.
+	chatHistory string
+}
+
+// Call numbers the input documents and runs the wrapped chain on them
+func (c numberedStuffDocuments) Call(ctx context.Context, values map[string]any, options ...chains.ChainCallOption) (map[string]any, error) {
+	docs, ok := values[c.InputKey].([]schema.Document)
+	if !ok {
+		return c.StuffDocuments.Call(ctx, values, options...)
+	}
+
+	numbered := make([]schema.Document, 0, len(docs))
+	for i, doc := range docs {
+		numbered = append(numbered, schema.Document{PageContent: numberedChunk(i+1, doc)})
+	}
+
+	inputValues := make(map[string]any, len(values))
+	for key, value := range values {
+		inputValues[key] = value
+	}
+	inputValues[c.InputKey] = numbered
+	inputValues["chat_history"] = c.chatHistory
+	return c.StuffDocuments.Call(ctx, inputValues, options...)
+}
+
+// numberedChunk renders a chunk with its citation label and where it comes from
+func numberedChunk(n int, doc schema.Document) string {
+	header := fmt.Sprintf("[%d]", n)
+	if source := metadataString(doc.Metadata, "source"); source != "" {
+		header += " Source: " + source
+	}
+	if section := metadataString(doc.Metadata, "heading_path"); section != "" {
+		header += " (" + section + ")"
+	}
+	return header + "\n" + doc.PageContent
+}
+
+// resolveCitations maps the citations in answer to sources, numbered from 1.
+// Citations of numbers without a source are removed from the returned answer
+// and reported in invalid. Citations are listed once, in order of appearance.
+// Brackets in fenced code blocks and inline code spans, or right after an
+// identifier, "]" or ")", index code and are left alone.
+func resolveCitations(answer string, sources []QuerySource) (cleaned string, citations []Citation, invalid []int) {
+	seen := map[int]bool{}
+	seenInvalid := map[int]bool{}
+	code := codeSpans(answer)
+
+	var b strings.Builder
+	last := 0
+	for _, m := range citationPattern.FindAllStringSubmatchIndex(answer, -1) {
+		bracket := m[3] // After the leading whitespace
+		if inSpans(code, bracket) || !opensCitation(answer, bracket) {
+			continue
+		}
+		b.WriteString(answer[last:m[0]])
+		last = m[1]
+
+		var valid []string
+		for _, field := range strings.Split(answer[m[4]:m[5]], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || n < 1 || n > len(sources) {
+				if !seenInvalid[n] {
+					seenInvalid[n] = true
+					invalid = append(invalid, n)
+				}
+				continue
+			}
+			valid = append(valid, strconv.Itoa(n))
+			if !seen[n] {
+				seen[n] = true
+				citations = append(citations, Citation{Number: n, Source: sources[n-1]})
+			}
+		}
+		if len(valid) == 0 {
+			continue // Drop the citation and the space before it
+		}
+		b.WriteString(answer[m[2]:m[3]] + "[" + strings.Join(valid, ", ") + "]")
+	}
+	b.WriteString(answer[last:])
+	return b.String(), citations, invalid
+}
+
+// opensCitation reports whether the bracket at i of text may open a citation
+// rather than index an expression such as items[0], m[k][1] or f(x)[1]
+func opensCitation(text string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return r != '_' && r != ']' && r != ')' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// codeSpans returns the byte ranges of the fenced code blocks and inline code
+// spans of markdown text. A fence left open runs to the end of text.
+func codeSpans(text string) [][2]int {
+	var spans [][2]int
+	proseStart, fenceStart, fence := 0, 0, ""
+	for offset := 0; offset < len(text); {
+		end := len(text)
+		if i := strings.IndexByte(text[offset:], '\n'); i >= 0 {
+			end = offset + i + 1
+		}
+		marker, rest := fenceMarker(text[offset:end])
+		switch {
+		case fence == "" && marker != "":
+			spans = append(spans, inlineCodeSpans(text, proseStart, offset)...)
+			fenceStart, fence = offset, marker
+		case fence != "" && strings.HasPrefix(marker, fence) && strings.TrimSpace(rest) == "":
+			spans = append(spans, [2]int{fenceStart, end})
+			proseStart, fence = end, ""
+		}
+		offset = end
+	}
+	if fence != "" {
+		return append(spans, [2]int{fenceStart, len(text)})
+	}
+	return append(spans, inlineCodeSpans(text, proseStart, len(text))...)
+}
+
+// fenceMarker returns the run of at least three backticks or tildes starting
+// line, indented by up to three spaces, and the rest of the line
+func fenceMarker(line string) (marker, rest string) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return "", line
+	}
+	for _, c := range []string{"`", "~"} {
+		if n := len(trimmed) - len(strings.TrimLeft(trimmed, c)); n >= 3 {
+			return trimmed[:n], trimmed[n:]
+		}
+	}
+	return "", line
+}
+
+// inlineCodeSpans returns the code spans of text[start:end]: a run of
+// backticks up to the next run of the same length. Unmatched runs are literal.
+func inlineCodeSpans(text string, start, end int) [][2]int {
+	var spans [][2]int
+	for i := start; i < end; {
+		if text[i] != '`' {
+			i++
+			continue
+		}
+		n := backtickRun(text[i:end])
+		closing := -1
+		for j := i + n; j < end; {
+			if text[j] != '`' {
+				j++
+				continue
+			}
+			m := backtickRun(text[j:end])
+			if m == n {
+				closing = j
+				break
+			}
+			j += m
+		}
+		if closing < 0 {
+			i += n
+			continue
+		}
+		spans = append(spans, [2]int{i, closing + n})
+		i = closing + n
+	}
+	return spans
+}
+
+// backtickRun returns the number of backticks s starts with
+func backtickRun(s string) int {
+	return len(s) - len(strings.TrimLeft(s, "`"))
+}
+
+// inSpans reports whether offset i lies in one of spans
+func inSpans(spans [][2]int, i int) bool {
+	for _, span := range spans {
+		if i >= span[0] && i < span[1] {
+			return true
+		}
+	}
+	return false
+}
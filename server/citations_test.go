@@ -0,0 +1,100 @@
+package server
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResolveCitations(t *testing.T) {
+	sources := []QuerySource{{Number: 1, URL: "https://example.com/a"}, {Number: 2, URL: "https://example.com/b"}}
+
+	tests := []struct {
+		name    string
+		answer  string
+		want    string
+		cited   []int
+		invalid []int
+	}{
+		{
+			name:   "prose",
+			answer: "Chains call models [1]. They can be nested [1, 2].",
+			want:   "Chains call models [1]. They can be nested [1, 2].",
+			cited:  []int{1, 2},
+		},
+		{
+			name:    "invalid numbers are removed",
+			answer:  "Chains call models [3]. Retrievers fetch chunks [2, 7].",
+			want:    "Chains call models. Retrievers fetch chunks [2].",
+			cited:   []int{2},
+			invalid: []int{3, 7},
+		},
+		{
+			name:   "at the start of a line",
+			answer: "[2] covers retrievers.",
+			want:   "[2] covers retrievers.",
+			cited:  []int{2},
+		},
+		{
+			name:   "after punctuation",
+			answer: "Use a retriever ([1]).",
+			want:   "Use a retriever ([1]).",
+			cited:  []int{1},
+		},
+		{
+			name:   "inline code",
+			answer: "Use `items[0]` or ``m[1]`` to read the first item [2].",
+			want:   "Use `items[0]` or ``m[1]`` to read the first item [2].",
+			cited:  []int{2},
+		},
+		{
+			name:   "indexing outside code",
+			answer: "Read items[0], m[k][1] and f(x)[2] first.",
+			want:   "Read items[0], m[k][1] and f(x)[2] first.",
+		},
+		{
+			name:   "fenced code",
+			answer: "Index the array [1]:\n\n```python\nx = arr[0]\ny = arr [1]\n```\n\nThen print it [2].",
+			want:   "Index the array [1]:\n\n```python\nx = arr[0]\ny = arr [1]\n```\n\nThen print it [2].",
+			cited:  []int{1, 2},
+		},
+		{
+			name:   "tilde fence with a longer closing fence",
+			answer: "~~~\nlist [5]\n~~~~\nDone [1].",
+			want:   "~~~\nlist [5]\n~~~~\nDone [1].",
+			cited:  []int{1},
+		},
+		{
+			name:   "unclosed fence",
+			answer: "Example [1]:\n```go\nv := xs [9]",
+			want:   "Example [1]:\n```go\nv := xs [9]",
+			cited:  []int{1},
+		},
+		{
+			name:    "unmatched backtick",
+			answer:  "A stray ` before [9].",
+			want:    "A stray ` before.",
+			invalid: []int{9},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, citations, invalid := resolveCitations(tt.answer, sources)
+			if got != tt.want {
+				t.Errorf("answer = %q, want %q", got, tt.want)
+			}
+			var cited []int
+			for _, c := range citations {
+				cited = append(cited, c.Number)
+				if c.Source != sources[c.Number-1] {
+					t.Errorf("citation [%d] has source %v", c.Number, c.Source)
+				}
+			}
+			if !slices.Equal(cited, tt.cited) {
+				t.Errorf("citations = %v, want %v", cited, tt.cited)
+			}
+			if !slices.Equal(invalid, tt.invalid) {
+				t.Errorf("invalid = %v, want %v", invalid, tt.invalid)
+			}
+		})
+	}
+}
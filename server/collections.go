@@ -0,0 +1,277 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"logging"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/avivnoah/documentation-assistant/pkg/collection"
+	"github.com/avivnoah/documentation-assistant/pkg/ingestion"
+	"github.com/avivnoah/documentation-assistant/pkg/keyword"
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// DefaultCollection is used by requests that name no collection. It is
+// configured by the server settings rather than recorded in the registry, and
+// cannot be deleted.
+const DefaultCollection = "default"
+
+// errDefaultCollection rejects attempts to create or delete the default collection
+var errDefaultCollection = errors.New("the default collection is configured by the server and cannot be created or deleted")
+
+// errEmbeddingDimension rejects collections whose embedding model makes
+// vectors the shared Pinecone index cannot hold
+var errEmbeddingDimension = errors.New("embedding dimension does not match the Pinecone index")
+
+// CreateCollectionRequest creates a collection. The embedding settings
+// default to the server's.
+type CreateCollectionRequest struct {
+	Name              string `json:"name"`
+	EmbeddingProvider string `json:"embedding_provider,omitempty"`
+	EmbeddingModel    string `json:"embedding_model,omitempty"`
+}
+
+type ListCollectionsResponse struct {
+	Collections []collection.Collection `json:"collections"`
+}
+
+type DeleteCollectionResponse struct {
+	Status     string `json:"status"`
+	Collection string `json:"collection"`
+	Deleted    int    `json:"deleted"` // Chunks removed from the vector store
+}
+
+// knowledgeBase is an opened collection: the stores holding its chunks
+type knowledgeBase struct {
+	collection collection.Collection
+	store      vectorstores.VectorStore
+	manifest   *ingestion.Manifest // Chunks stored per ingested source
+	keywords   *keyword.Index      // BM25 index of the stored chunks
+}
+
+// defaultCollection describes the collection configured by the server settings
+func (s *Server) defaultCollection() collection.Collection {
+	return collection.Collection{
+		Name:              DefaultCollection,
+		Namespace:         s.config.PineconeNamespace,
+		EmbeddingProvider: s.config.EmbeddingProvider,
+		EmbeddingModel:    s.config.EmbeddingModel,
+	}
+}
+
+// knowledgeBase returns the collection called name, opening its stores on
+// first use. An empty name selects DefaultCollection.
+func (s *Server) knowledgeBase(ctx context.Context, name string) (*knowledgeBase, error) {
+	if name == "" {
+		name = DefaultCollection
+	}
+
+	s.basesMu.Lock()
+	defer s.basesMu.Unlock()
+	if kb, ok := s.bases[name]; ok {
+		return kb, nil
+	}
+
+	c := s.defaultCollection()
+	if name != DefaultCollection {
+		var err error
+		if c, err = s.collections.Get(name); err != nil {
+			return nil, err
+		}
+	}
+	// The stores outlive the request, so they must not be bound to its deadline
+	kb, err := openKnowledgeBase(context.WithoutCancel(ctx), s.logger, s.config, c)
+	if err != nil {
+		return nil, err
+	}
+	s.bases[name] = kb
+	return kb, nil
+}
+
+// collectionPaths returns the files of the local vector store, manifest and
+// keyword index of c. The default collection keeps the configured paths.
+func collectionPaths(config Config, c collection.Collection) (store, manifest, keywords string) {
+	if c.Name == DefaultCollection {
+		return config.LocalStorePath, config.ManifestPath, config.KeywordIndexPath
+	}
+	dir := filepath.Join(config.CollectionsDir, c.Name)
+	return filepath.Join(dir, "vectorstore.json"), filepath.Join(dir, "manifest.json"), filepath.Join(dir, "keywords.json")
+}
+
+// openKnowledgeBase opens the vector store, manifest and keyword index of c
+func openKnowledgeBase(ctx context.Context, logger logging.Logger, config Config, c collection.Collection) (*knowledgeBase, error) {
+	storePath, manifestPath, keywordsPath := collectionPaths(config, c)
+	store, err := initializeVectorStore(ctx, logger, config, c, storePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize vector store: %w", err)
+	}
+
+	// The manifest and keyword index must live as long as the stored vectors
+	kb := &knowledgeBase{collection: c, store: store, manifest: ingestion.NewManifest(), keywords: keyword.NewIndex()}
+	if config.VectorStore != VectorStoreMemory {
+		if kb.manifest, err = ingestion.OpenManifest(manifestPath); err != nil {
+			return nil, err
+		}
+		if kb.keywords, err = keyword.Open(keywordsPath); err != nil {
+			return nil, err
+		}
+	}
+	return kb, nil
+}
+
+// embeddingBaseURL returns the configured embedding endpoint when c uses the
+// configured provider; other providers use their public API
+func embeddingBaseURL(config Config, c collection.Collection) string {
+	if c.EmbeddingProvider != config.EmbeddingProvider {
+		return ""
+	}
+	return config.EmbeddingBaseURL
+}
+
+// handleCreateCollection records a new collection. Its stores are created
+// when it is first used.
+func (s *Server) handleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	var req CreateCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == DefaultCollection || req.Name == s.config.PineconeNamespace {
+		respondWithError(w, fmt.Sprintf("collection name %q is reserved", req.Name), http.StatusConflict)
+		return
+	}
+
+	c := collection.Collection{
+		Name:              req.Name,
+		EmbeddingProvider: req.EmbeddingProvider,
+		EmbeddingModel:    req.EmbeddingModel,
+	}
+	if c.EmbeddingProvider == "" {
+		c.EmbeddingProvider = s.config.EmbeddingProvider
+		c.EmbeddingModel = cmp.Or(c.EmbeddingModel, s.config.EmbeddingModel)
+	}
+	if c.EmbeddingProvider == ProviderOpenAI && c.EmbeddingModel == "" {
+		c.EmbeddingModel = "text-embedding-3-small"
+	}
+	embedder, err := newEmbedder(r.Context(), c.EmbeddingProvider, c.EmbeddingModel, embeddingBaseURL(s.config, c))
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.checkEmbeddingDimension(r.Context(), embedder); err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+
+	c, err = s.collections.Create(c)
+	if err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+	s.logger.Info(r.Context(), "Collection created", map[string]any{"collection": c.Name, "embedding_provider": c.EmbeddingProvider, "embedding_model": c.EmbeddingModel})
+
+	w.Header().Set("Location", "/collections/"+c.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// checkEmbeddingDimension compares the dimension of the vectors made by
+// embedder with the configured Pinecone index, which every collection shares.
+// Other vector stores keep each collection apart and accept any dimension.
+func (s *Server) checkEmbeddingDimension(ctx context.Context, embedder embeddings.Embedder) error {
+	if s.config.VectorStore != VectorStorePinecone {
+		return nil
+	}
+	kb, err := s.knowledgeBase(ctx, DefaultCollection)
+	if err != nil {
+		return err
+	}
+	index, ok := kb.store.(interface {
+		Dimension(ctx context.Context) (int, error)
+	})
+	if !ok {
+		return nil
+	}
+
+	want, err := index.Dimension(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read the Pinecone index dimension: %w", err)
+	}
+	vector, err := embedder.EmbedQuery(ctx, "dimension probe")
+	if err != nil {
+		return fmt.Errorf("failed to embed with the collection's model: %w", err)
+	}
+	if len(vector) != want {
+		return fmt.Errorf("%w: the model makes %d-dimensional vectors, the index holds %d", errEmbeddingDimension, len(vector), want)
+	}
+	return nil
+}
+
+// handleListCollections lists the default collection followed by the created ones
+func (s *Server) handleListCollections(w http.ResponseWriter, r *http.Request) {
+	collections := append([]collection.Collection{s.defaultCollection()}, s.collections.List()...)
+	respondWithJSON(w, ListCollectionsResponse{Collections: collections})
+}
+
+// handleDeleteCollection deletes a collection with every chunk stored in it
+func (s *Server) handleDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == DefaultCollection {
+		respondWithError(w, errDefaultCollection.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	kb, err := s.knowledgeBase(ctx, name)
+	if err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+	store, ok := kb.store.(vectorstore.Store)
+	if !ok {
+		respondWithError(w, "Vector store does not support deletion", http.StatusNotImplemented)
+		return
+	}
+	// A running job would keep storing into the deleted namespace and recreate
+	// its manifest and keyword index. Once deleted, the knowledge base stays
+	// marked, so requests that looked it up before cannot start jobs in it.
+	endWipe, err := s.jobs.startWipe(kb)
+	if err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+
+	deleted, err := store.Delete(ctx, nil)
+	if err != nil {
+		endWipe()
+		s.logger.Error(ctx, "Failed to delete collection", map[string]any{"error": err.Error(), "collection": name})
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.collections.Delete(name); err != nil {
+		endWipe()
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+
+	s.basesMu.Lock()
+	delete(s.bases, name)
+	s.basesMu.Unlock()
+	if s.config.VectorStore != VectorStoreMemory {
+		if err := os.RemoveAll(filepath.Join(s.config.CollectionsDir, name)); err != nil {
+			s.logger.Error(ctx, "Failed to remove collection files", map[string]any{"error": err.Error(), "collection": name})
+		}
+	}
+
+	s.logger.Info(ctx, "Collection deleted", map[string]any{"collection": name, "deleted": deleted})
+	respondWithJSON(w, DeleteCollectionResponse{Status: "deleted", Collection: name, Deleted: deleted})
+}
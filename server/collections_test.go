@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"logging"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/avivnoah/documentation-assistant/pkg/collection"
+	"github.com/avivnoah/documentation-assistant/pkg/ingestion"
+	"github.com/avivnoah/documentation-assistant/pkg/keyword"
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+)
+
+// sizedEmbedder embeds every text as a vector of dimension ones
+type sizedEmbedder struct{ dimension int }
+
+func (e sizedEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i], _ = e.EmbedQuery(ctx, texts[i])
+	}
+	return vectors, nil
+}
+
+func (e sizedEmbedder) EmbedQuery(context.Context, string) ([]float32, error) {
+	vector := make([]float32, e.dimension)
+	for i := range vector {
+		vector[i] = 1
+	}
+	return vector, nil
+}
+
+// indexStore is a memory store reporting a Pinecone index dimension
+type indexStore struct {
+	*vectorstore.Memory
+	dimension int
+}
+
+func (s indexStore) Dimension(context.Context) (int, error) { return s.dimension, nil }
+
+func newTestServer(config Config) *Server {
+	return &Server{
+		config:      config,
+		logger:      logging.New(),
+		jobs:        newJobRegistry(""),
+		collections: collection.NewRegistry(),
+		bases:       map[string]*knowledgeBase{},
+	}
+}
+
+func TestCheckEmbeddingDimension(t *testing.T) {
+	s := newTestServer(Config{VectorStore: VectorStorePinecone})
+	s.bases[DefaultCollection] = &knowledgeBase{
+		collection: collection.Collection{Name: DefaultCollection},
+		store:      indexStore{Memory: vectorstore.NewMemory(sizedEmbedder{1536}), dimension: 1536},
+	}
+
+	if err := s.checkEmbeddingDimension(context.Background(), sizedEmbedder{1536}); err != nil {
+		t.Errorf("matching dimension: %v", err)
+	}
+	err := s.checkEmbeddingDimension(context.Background(), sizedEmbedder{768})
+	if !errors.Is(err, errEmbeddingDimension) || requestErrorStatus(err) != http.StatusBadRequest {
+		t.Errorf("mismatched dimension: %v, want a 400 errEmbeddingDimension", err)
+	}
+
+	s.config.VectorStore = VectorStoreMemory
+	if err := s.checkEmbeddingDimension(context.Background(), sizedEmbedder{768}); err != nil {
+		t.Errorf("memory store: %v, want any dimension accepted", err)
+	}
+}
+
+func TestDeleteCollectionWithRunningJob(t *testing.T) {
+	s := newTestServer(Config{VectorStore: VectorStoreMemory})
+	c, err := s.collections.Create(collection.Collection{Name: "billing", EmbeddingProvider: ProviderOllama})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb := &knowledgeBase{collection: c, store: vectorstore.NewMemory(sizedEmbedder{4}), manifest: ingestion.NewManifest(), keywords: keyword.NewIndex()}
+	s.bases[c.Name] = kb
+	job, err := s.jobs.create(IngestRequest{URL: "https://example.com", Collection: c.Name}, ingestion.Source{URL: "https://example.com"}, ingestion.Options{}, kb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /collections/{name}", s.handleDeleteCollection)
+	deleteCollection := func() int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/collections/billing", nil))
+		return w.Code
+	}
+
+	if code := deleteCollection(); code != http.StatusConflict {
+		t.Fatalf("deleting with a running job answered %d, want 409", code)
+	}
+	if _, err := s.collections.Get(c.Name); err != nil {
+		t.Fatalf("collection was deleted: %v", err)
+	}
+
+	job.finish(ingestion.Result{}, nil)
+	if code := deleteCollection(); code != http.StatusOK {
+		t.Fatalf("deleting once the job finished answered %d, want 200", code)
+	}
+	if _, err := s.collections.Get(c.Name); !errors.Is(err, collection.ErrNotFound) {
+		t.Fatalf("collection still exists: %v", err)
+	}
+	if _, err := s.jobs.create(IngestRequest{URL: "https://example.com", Collection: c.Name}, ingestion.Source{URL: "https://example.com"}, ingestion.Options{}, kb, nil); !errors.Is(err, errCollectionBusy) {
+		t.Fatalf("starting a job in the deleted collection: %v, want %v", err, errCollectionBusy)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/avivnoah/documentation-assistant/pkg/ingestion"
+)
+
+// errInvalidFilters rejects queries whose filters cannot match anything
+var errInvalidFilters = errors.New("invalid filters")
+
+// QueryFilters restricts retrieval to chunks whose metadata matches every set field
+type QueryFilters struct {
+	Host           string     `json:"host,omitempty"`            // Host of the page, e.g. docs.example.com
+	URLPrefix      string     `json:"url_prefix,omitempty"`      // Page URL or path, or a directory of it
+	Tags           []string   `json:"tags,omitempty"`            // Any of the tags given at ingestion
+	IngestedAfter  *time.Time `json:"ingested_after,omitempty"`  // Chunks stored at or after this time
+	IngestedBefore *time.Time `json:"ingested_before,omitempty"` // Chunks stored at or before this time
+}
+
+// metadataFilter converts f to a metadata filter in Pinecone's syntax, which
+// the memory and local stores and the keyword index evaluate the same way.
+// It returns nil when f sets nothing.
+func (f *QueryFilters) metadataFilter() (map[string]any, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	filter := map[string]any{}
+	if f.Host != "" {
+		host := strings.ToLower(f.Host)
+		if u, err := url.Parse(f.Host); err == nil && u.Host != "" {
+			host = strings.ToLower(u.Hostname()) // Accept a URL as well
+		}
+		filter[ingestion.HostKey] = map[string]any{"$eq": host}
+	}
+	if f.URLPrefix != "" {
+		filter[ingestion.URLPrefixesKey] = map[string]any{"$in": urlPrefixCandidates(f.URLPrefix)}
+	}
+	if len(f.Tags) > 0 {
+		tags := make([]any, 0, len(f.Tags))
+		for _, tag := range f.Tags {
+			tags = append(tags, tag)
+		}
+		filter[ingestion.TagsKey] = map[string]any{"$in": tags}
+	}
+	if f.IngestedAfter != nil || f.IngestedBefore != nil {
+		if f.IngestedAfter != nil && f.IngestedBefore != nil && f.IngestedAfter.After(*f.IngestedBefore) {
+			return nil, fmt.Errorf("%w: ingested_after is later than ingested_before", errInvalidFilters)
+		}
+		ingested := map[string]any{}
+		if f.IngestedAfter != nil {
+			ingested["$gte"] = f.IngestedAfter.Unix()
+		}
+		if f.IngestedBefore != nil {
+			ingested["$lte"] = f.IngestedBefore.Unix()
+		}
+		filter[ingestion.IngestedAtKey] = ingested
+	}
+
+	if len(filter) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// urlPrefixCandidates returns the entries of a chunk's url_prefixes that
+// match prefix. A prefix without a trailing slash names either a page or a
+// directory, so both forms are accepted.
+func urlPrefixCandidates(prefix string) []any {
+	// Normalize like ingestion.URLPrefixes: lowercase scheme and host, no query or fragment
+	normalized := ingestion.URLPrefixes(prefix)[0]
+	candidates := []any{normalized}
+	if !strings.HasSuffix(normalized, "/") {
+		candidates = append(candidates, normalized+"/")
+	}
+	return candidates
+}
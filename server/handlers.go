@@ -3,8 +3,17 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"path/filepath"
+	"strings"
 
+	"github.com/avivnoah/documentation-assistant/pkg/collection"
+	"github.com/avivnoah/documentation-assistant/pkg/ingestion"
+	"github.com/avivnoah/documentation-assistant/pkg/session"
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/memory"
 	"github.com/tmc/langchaingo/schema"
 )
@@ -13,24 +22,65 @@ type QueryRequest struct {
 	Query       string     `json:"query"`
 	NumDocs     int        `json:"num_docs"`
 	ChatHistory [][]string `json:"chat_history,omitempty"` // Array of [role, content] pairs
-}
+	SessionID   string     `json:"session_id,omitempty"`   // Server-side conversation; replaces chat_history
+	Model       string     `json:"model,omitempty"`        // Overrides the configured model for this request
+	// RetrievalMode is one of the Retrieval* modes; empty uses the server configuration
+	RetrievalMode string `json:"retrieval_mode,omitempty"`
+	// Rerank is one of the Rerank* rerankers; empty uses the server configuration
+	Rerank  string        `json:"rerank,omitempty"`
+	Filters *QueryFilters `json:"filters,omitempty"` // Restricts retrieval to matching chunks
+	// Collection to answer from; empty uses DefaultCollection
+	Collection string `json:"collection,omitempty"`
+
+	// MemoryStrategy selects how the chat history is trimmed, one of the
+	// MemoryStrategy* constants. Zero values fall back to the server configuration.
+	MemoryStrategy string `json:"memory_strategy,omitempty"`
+	MemoryTurns    int    `json:"memory_turns,omitempty"`  // Turns kept by last_n
+	MemoryTokens   int    `json:"memory_tokens,omitempty"` // Token budget of token_budget and summary
 
-type QueryResponse struct {
-	Result          interface{} `json:"result"`
-	Query           string      `json:"query"`
-	SourceDocuments interface{} `json:"source_documents,omitempty"`
-	Error           string      `json:"error,omitempty"`
+	// TimeoutMs bounds the whole query, from condensing the question to the
+	// last answer token. Zero uses the server configuration.
+	TimeoutMs int `json:"timeout_ms,omitempty"`
 }
 
 type IngestRequest struct {
-	URL string `json:"url"`
+	URL    string `json:"url,omitempty"`
+	Path   string `json:"path,omitempty"`    // Local directory, relative to the configured ingest root
+	GitURL string `json:"git_url,omitempty"` // Git repository to clone
+	GitRef string `json:"git_ref,omitempty"` // Optional branch or tag of git_url
+
+	// Include and Exclude are URL regular expressions applied by the native web crawler
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	Tags    []string `json:"tags,omitempty"` // Stored on every chunk for query filters
+
+	Collection string `json:"collection,omitempty"` // Collection to store into; empty uses DefaultCollection
 }
 
 type IngestResponse struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
 	URL     string `json:"url,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Path    string `json:"path,omitempty"`
+	GitURL  string `json:"git_url,omitempty"`
+	JobID   string `json:"job_id,omitempty"`
+	// Collection the source is stored into
+	Collection string `json:"collection,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type ResetRequest struct {
+	Confirm    bool   `json:"confirm"`
+	Source     string `json:"source,omitempty"`     // Only delete documents with this source metadata
+	Collection string `json:"collection,omitempty"` // Collection to reset; empty uses DefaultCollection
+}
+
+type ResetResponse struct {
+	Status     string `json:"status"`
+	Collection string `json:"collection"`
+	Namespace  string `json:"namespace"`
+	Source     string `json:"source,omitempty"`
+	Deleted    int    `json:"deleted"`
 }
 
 // handleQuery processes query requests to the LLM
@@ -40,38 +90,77 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req QueryRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, "Invalid request body", http.StatusBadRequest)
+	if r.URL.Query().Get("stream") == "true" {
+		s.handleQueryStream(w, r)
 		return
 	}
 
-	if req.NumDocs == 0 {
-		req.NumDocs = 5
+	req, err := decodeQueryRequest(r)
+	if err != nil {
+		respondWithError(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	// Convert chat history from JSON format
-	chatHistory := convertChatHistory(req.ChatHistory)
+	ctx, cancel, err := s.queryContext(r, req)
+	if err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+	defer cancel()
+	if err := s.validateModel(req.Model); err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
 
-	// Create a NEW conversationMemory for THIS request with the chatHistory
-	conversationMemory := memory.NewConversationBuffer(
-		memory.WithChatHistory(chatHistory),
-		memory.WithInputKey("question"),
-		memory.WithOutputKey("text"),
-	)
+	retrieval, err := s.retrievalOptions(ctx, req)
+	if err != nil {
+		s.respondWithQueryError(ctx, w, err)
+		return
+	}
+	conversationMemory, memoryReport, err := s.conversationMemory(ctx, req)
+	if err != nil {
+		s.respondWithQueryError(ctx, w, err)
+		return
+	}
 
-	// Import and call your runLLM function (pass the pointer directly)
-	result, err := runLLM(context.Background(), s.logger, &s.store, req.NumDocs, req.Query, conversationMemory)
+	result, err := s.runLLM(ctx, retrieval, req.Query, req.Model, conversationMemory, nil)
 	if err != nil {
-		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		s.respondWithQueryError(ctx, w, err)
 		return
 	}
 
-	respondWithJSON(w, QueryResponse{
-		Result:          result["result"],
-		Query:           req.Query,
-		SourceDocuments: result["source_documents"],
-	})
+	answer, _ := result["result"].(string)
+	docs, _ := result["source_documents"].([]schema.Document)
+	response := newQueryResponse(req.Query, answer, docs)
+	response.SessionID = req.SessionID
+	response.Memory = memoryReport
+	response.RetrievalMode = retrieval.Mode
+	response.Rerank = retrieval.Rerank
+	response.Collection = retrieval.base.collection.Name
+	s.recordTurn(r.Context(), req, response.Answer)
+	respondWithJSON(w, response)
+}
+
+// decodeQueryRequest reads a QueryRequest from the body and applies defaults
+func decodeQueryRequest(r *http.Request) (QueryRequest, error) {
+	var req QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, err
+	}
+
+	if req.NumDocs == 0 {
+		req.NumDocs = 5
+	}
+	return req, nil
+}
+
+// newConversationMemory creates a fresh memory for a single request seeded with the client's chat history
+func newConversationMemory(history [][]string) *memory.ConversationBuffer {
+	return memory.NewConversationBuffer(
+		memory.WithChatHistory(convertChatHistory(history)),
+		memory.WithInputKey("question"),
+		memory.WithOutputKey("text"),
+	)
 }
 
 // convertChatHistory converts the JSON chat history format to schema.ChatMessageHistory
@@ -91,12 +180,17 @@ func convertChatHistory(history [][]string) schema.ChatMessageHistory {
 			chatHistory.AddUserMessage(context.Background(), content)
 		case "ai", "assistant":
 			chatHistory.AddAIMessage(context.Background(), content)
+		case "system":
+			chatHistory.AddMessage(context.Background(), llms.SystemChatMessage{Content: content})
 		}
 	}
 
 	return chatHistory
 }
 
+// errInvalidIngest rejects ingest requests with an invalid source or URL pattern
+var errInvalidIngest = errors.New("invalid ingest request")
+
 // handleIngest processes documentation ingestion requests
 func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -110,33 +204,254 @@ func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.URL == "" {
-		respondWithError(w, "URL is required", http.StatusBadRequest)
+	job, err := s.startIngestJob(r.Context(), req, nil)
+	if err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
 		return
 	}
 
-	s.logger.Info(context.Background(), "Starting ingestion", map[string]any{"url": req.URL})
-
-	// Run ingestion in background
-	go s.runIngestion(req.URL)
-
 	respondWithJSON(w, IngestResponse{
 		Status:  "started",
 		Message: "Ingestion process started in background",
 		URL:     req.URL,
+		Path:    req.Path,
+		GitURL:  req.GitURL,
+		JobID:   job.snapshot().ID,
+
+		Collection: job.base.collection.Name,
 	})
 }
 
+// startIngestJob validates req and runs it as a background job. A non-nil
+// record resumes a job interrupted by a previous run.
+func (s *Server) startIngestJob(ctx context.Context, req IngestRequest, record *jobRecord) (*ingestJob, error) {
+	source := ingestion.Source{URL: req.URL, Path: req.Path, GitURL: req.GitURL, GitRef: req.GitRef}
+	if err := source.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidIngest, err)
+	}
+
+	if source.Path != "" {
+		path, err := resolveIngestPath(s.config.IngestRoot, source.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidIngest, err)
+		}
+		source.Path = path
+	}
+
+	kb, err := s.knowledgeBase(ctx, req.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := ingestion.DefaultOptions()
+	opts.WebCrawler = s.config.WebCrawler
+	opts.Include = req.Include
+	opts.Exclude = req.Exclude
+	opts.Tags = req.Tags
+	for _, patterns := range [][]string{req.Include, req.Exclude} {
+		if _, err := ingestion.CompilePatterns(patterns); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidIngest, err)
+		}
+	}
+
+	job, err := s.jobs.create(req, source, opts, kb, record)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info(ctx, "Starting ingestion", map[string]any{"source": source.String(), "job_id": job.snapshot().ID, "collection": kb.collection.Name})
+
+	// Run ingestion in background
+	go s.runIngestion(job)
+	return job, nil
+}
+
 // runIngestion executes the ingestion process asynchronously
-func (s *Server) runIngestion(url string) {
-	ctx := context.Background()
+func (s *Server) runIngestion(job *ingestJob) {
+	ctx := job.ctx
+	status := job.snapshot()
+
+	opts := job.opts
+	opts.Progress = job
+	opts.Manifest = job.base.manifest
+	opts.KeywordIndex = job.base.keywords
+	result, err := Ingest(ctx, s.logger, &job.base.store, job.source, opts)
+	job.finish(result, err)
+
+	// Interrupted jobs stay recorded and run again on the next start
+	state := job.snapshot().State
+	if state != JobInterrupted {
+		if err := s.jobs.forget(status.ID); err != nil {
+			s.logger.Error(ctx, "Failed to remove ingestion job record", map[string]any{"error": err.Error(), "job_id": status.ID})
+		}
+	}
+
+	switch {
+	case state == JobCancelled, state == JobInterrupted:
+		s.logger.Info(ctx, "Ingestion stopped", map[string]any{"source": job.source.String(), "job_id": status.ID, "state": state, "batches_stored": result.BatchesStored})
+	case err != nil:
+		s.logger.Error(ctx, "Ingestion failed", map[string]any{"error": err.Error(), "source": job.source.String(), "job_id": status.ID})
+	default:
+		s.logger.Info(ctx, "Ingestion completed successfully", map[string]any{"source": job.source.String(), "job_id": status.ID})
+	}
+}
+
+// resolveIngestPath maps a requested directory onto the configured ingest root
+// and rejects anything outside it. Local ingestion is disabled without a root.
+func resolveIngestPath(root, path string) (string, error) {
+	if root == "" {
+		return "", errors.New("local path ingestion is disabled; set INGEST_ROOT to enable it")
+	}
 
-	// Import and call your ingest function
-	if err := Ingest(ctx, s.logger, &s.store, url); err != nil {
-		s.logger.Error(ctx, "Ingestion failed", map[string]any{"error": err.Error(), "url": url})
-	} else {
-		s.logger.Info(ctx, "Ingestion completed successfully", map[string]any{"url": url})
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid ingest root: %w", err)
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid ingest root: %w", err)
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside the ingest root", path)
+	}
+	return resolved, nil
+}
+
+// handleIngestStatus reports the progress of an ingestion job
+func (s *Server) handleIngestStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		respondWithError(w, "Ingestion job not found", http.StatusNotFound)
+		return
+	}
+
+	respondWithJSON(w, job.snapshot())
+}
+
+// handleCancelIngest cancels an ingestion job and answers with its final
+// status once the batches being stored are written
+func (s *Server) handleCancelIngest(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		respondWithError(w, "Ingestion job not found", http.StatusNotFound)
+		return
+	}
+	if !job.stop(errJobCancelled) {
+		respondWithError(w, fmt.Sprintf("Ingestion job already %s", job.snapshot().State), http.StatusConflict)
+		return
+	}
+
+	s.logger.Info(r.Context(), "Cancelling ingestion", map[string]any{"job_id": r.PathValue("id")})
+	select {
+	case <-job.done:
+		respondWithJSON(w, job.snapshot())
+	case <-r.Context().Done():
+	}
+}
+
+// handleReset deletes documents from the configured vector namespace
+func (s *Server) handleReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !req.Confirm {
+		respondWithError(w, "Reset must be confirmed with \"confirm\": true", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	kb, err := s.knowledgeBase(ctx, req.Collection)
+	if err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+	namespace := kb.collection.Namespace
+
+	// A running job would store chunks and manifest entries after the wipe,
+	// so none may run or start until the reset is over
+	endWipe, err := s.jobs.startWipe(kb)
+	if err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+	defer endWipe()
+
+	store, ok := kb.store.(vectorstore.Store)
+	if !ok {
+		respondWithError(w, "Vector store does not support deletion", http.StatusNotImplemented)
+		return
+	}
+
+	s.logger.Info(ctx, "Resetting vector namespace", map[string]any{"namespace": namespace, "collection": kb.collection.Name, "source": req.Source})
+
+	deleted, err := deleteDocuments(ctx, store, kb.manifest, req.Source)
+	if err != nil {
+		s.logger.Error(ctx, "Reset failed", map[string]any{"error": err.Error(), "namespace": namespace})
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Forget the deleted chunks so the next ingest embeds them again
+	if err := kb.manifest.Forget(req.Source); err != nil {
+		s.logger.Error(ctx, "Failed to update ingestion manifest", map[string]any{"error": err.Error()})
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+
+	if _, err := kb.keywords.DeleteSource(req.Source); err != nil {
+		s.logger.Error(ctx, "Failed to update keyword index", map[string]any{"error": err.Error()})
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Info(ctx, "Reset completed", map[string]any{"namespace": namespace, "deleted": deleted})
+	respondWithJSON(w, ResetResponse{
+		Status:     "reset",
+		Collection: kb.collection.Name,
+		Namespace:  namespace,
+		Source:     req.Source,
+		Deleted:    deleted,
+	})
+}
+
+// deleteDocuments removes the chunks of source, or every chunk when source is
+// empty. A source is deleted by the chunk IDs its manifest recorded, which
+// every store supports; stores that can also delete by metadata filter then
+// remove chunks stored before the manifest existed.
+func deleteDocuments(ctx context.Context, store vectorstore.Store, manifest *ingestion.Manifest, source string) (int, error) {
+	if source == "" {
+		return store.Delete(ctx, nil)
+	}
+
+	ids := manifest.PageIDs(source)
+	if err := store.DeleteIDs(ctx, ids); err != nil {
+		return 0, err
+	}
+	deleted, err := store.Delete(ctx, map[string]any{"source": source})
+	if errors.Is(err, vectorstore.ErrFilteredDelete) {
+		return len(ids), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(ids) + deleted, nil
 }
 
 // handleHealth returns server health status
@@ -158,3 +473,28 @@ func respondWithError(w http.ResponseWriter, message string, statusCode int) {
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(map[string]string{"error": message})
 }
+
+// respondWithErrorCode is respondWithError with a machine readable code, such as ErrorCodeTimeout
+func respondWithErrorCode(w http.ResponseWriter, message, code string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message, "code": code})
+}
+
+// requestErrorStatus maps the errors returned to requests to HTTP status codes
+func requestErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, session.ErrNotFound), errors.Is(err, collection.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, collection.ErrExists), errors.Is(err, errIngestionRunning), errors.Is(err, errCollectionBusy):
+		return http.StatusConflict
+	case errors.Is(err, errSessionWithHistory), errors.Is(err, errUnknownMemoryStrategy),
+		errors.Is(err, errUnknownRetrievalMode), errors.Is(err, errUnknownReranker),
+		errors.Is(err, errInvalidFilters), errors.Is(err, collection.ErrInvalidName),
+		errors.Is(err, errInvalidTimeout), errors.Is(err, errInvalidIngest),
+		errors.Is(err, errUnknownModel), errors.Is(err, errEmbeddingDimension):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
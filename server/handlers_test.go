@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avivnoah/documentation-assistant/pkg/ingestion"
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// idStore is a memory store that, like a Pinecone serverless index, cannot
+// delete by metadata filter
+type idStore struct{ *vectorstore.Memory }
+
+func (s idStore) Delete(ctx context.Context, filter map[string]any) (int, error) {
+	if len(filter) > 0 {
+		return 0, vectorstore.ErrFilteredDelete
+	}
+	return s.Memory.Delete(ctx, filter)
+}
+
+func TestDeleteDocuments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	data := `{"sources": {"https://example.com": {"pages": {"https://example.com/a": ["a1", "a2"]}}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := ingestion.OpenManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		store     func(*vectorstore.Memory) vectorstore.Store
+		deleted   int
+		remaining int
+	}{
+		// The chunk stored before the manifest existed is found by the filter
+		{"filtered delete", func(m *vectorstore.Memory) vectorstore.Store { return m }, 3, 1},
+		{"delete by ID only", func(m *vectorstore.Memory) vectorstore.Store { return idStore{m} }, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := vectorstore.NewMemory(sizedEmbedder{4})
+			var docs []schema.Document
+			for id, source := range map[string]string{"a1": "https://example.com/a", "a2": "https://example.com/a", "legacy": "https://example.com/a", "b1": "https://example.com/b"} {
+				docs = append(docs, schema.Document{PageContent: id, Metadata: map[string]any{vectorstore.ChunkIDKey: id, "source": source}})
+			}
+			if _, err := memory.AddDocuments(context.Background(), docs); err != nil {
+				t.Fatal(err)
+			}
+
+			deleted, err := deleteDocuments(context.Background(), tt.store(memory), manifest, "https://example.com/a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted != tt.deleted {
+				t.Errorf("deleted %d chunks, want %d", deleted, tt.deleted)
+			}
+			if remaining, _ := memory.Delete(context.Background(), nil); remaining != tt.remaining {
+				t.Errorf("%d chunks left, want %d", remaining, tt.remaining)
+			}
+		})
+	}
+}
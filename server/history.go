@@ -0,0 +1,173 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/avivnoah/documentation-assistant/pkg/session"
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/memory"
+)
+
+// Memory strategies accepted in QueryRequest.MemoryStrategy and Config.MemoryStrategy.
+// A turn is one message of the chat history.
+const (
+	MemoryStrategyFull        = "full"         // Keep every turn
+	MemoryStrategyLastN       = "last_n"       // Keep the last memory_turns turns
+	MemoryStrategyTokenBudget = "token_budget" // Keep the newest turns that fit in memory_tokens
+	MemoryStrategySummary     = "summary"      // As token_budget, with older turns folded into a running summary
+)
+
+// Defaults of Config.MemoryTurns and Config.MemoryTokens
+const (
+	defaultMemoryTurns  = 10
+	defaultMemoryTokens = 2000
+)
+
+// tokenEncoding is the tokenizer used to measure the chat history. Providers
+// tokenize differently, so counts are an estimate for non-OpenAI models.
+const tokenEncoding = "cl100k_base"
+
+// errUnknownMemoryStrategy rejects queries asking for a strategy that does not exist
+var errUnknownMemoryStrategy = errors.New("unknown memory strategy")
+
+// MemoryReport describes how the chat history of a query was trimmed
+type MemoryReport struct {
+	Strategy        string `json:"strategy"`
+	TurnsKept       int    `json:"turns_kept"`       // Turns passed to the model verbatim
+	TurnsSummarized int    `json:"turns_summarized"` // Older turns passed as the running summary
+	TurnsDropped    int    `json:"turns_dropped"`    // Turns left out entirely
+	Tokens          int    `json:"tokens"`           // Estimated tokens of the kept turns and summary
+}
+
+// validateMemoryStrategy accepts the Memory* strategies and the empty default
+func validateMemoryStrategy(strategy string) error {
+	switch strategy {
+	case "", MemoryStrategyFull, MemoryStrategyLastN, MemoryStrategyTokenBudget, MemoryStrategySummary:
+		return nil
+	default:
+		return fmt.Errorf("%w %q", errUnknownMemoryStrategy, strategy)
+	}
+}
+
+// conversationMemory builds the memory a query is answered with from the
+// conversation preceding it, trimmed with the request's memory strategy
+func (s *Server) conversationMemory(ctx context.Context, req QueryRequest) (*memory.ConversationBuffer, MemoryReport, error) {
+	if err := validateMemoryStrategy(req.MemoryStrategy); err != nil {
+		return nil, MemoryReport{}, err
+	}
+	sess, err := s.chatHistory(ctx, req)
+	if err != nil {
+		return nil, MemoryReport{}, err
+	}
+
+	strategy := cmp.Or(req.MemoryStrategy, s.config.MemoryStrategy)
+	maxTurns := cmp.Or(req.MemoryTurns, s.config.MemoryTurns)
+	maxTokens := cmp.Or(req.MemoryTokens, s.config.MemoryTokens)
+
+	turns := sess.Turns
+	report := MemoryReport{Strategy: strategy}
+	keepFrom := 0
+	summary := ""
+	switch strategy {
+	case MemoryStrategyLastN:
+		keepFrom = max(0, len(turns)-maxTurns)
+	case MemoryStrategyTokenBudget:
+		keepFrom = budgetStart(turns, maxTokens)
+	case MemoryStrategySummary:
+		summary, report.TurnsSummarized = sess.Summary, sess.SummarizedTurns
+		if report.TurnsSummarized > len(turns) {
+			summary, report.TurnsSummarized = "", 0 // Not a summary of this transcript
+		}
+		keepFrom = max(budgetStart(turns, maxTokens), report.TurnsSummarized)
+		if keepFrom > report.TurnsSummarized {
+			summary, err = s.summarizeTurns(ctx, req.Model, summary, turns[report.TurnsSummarized:keepFrom])
+			if err != nil {
+				return nil, MemoryReport{}, fmt.Errorf("failed to summarize chat history: %w", err)
+			}
+			report.TurnsSummarized = keepFrom
+			if req.SessionID != "" {
+				if err := s.sessions.SetSummary(ctx, req.SessionID, summary, keepFrom); err != nil {
+					s.logger.Error(ctx, "Failed to save session summary", map[string]any{"error": err.Error(), "session_id": req.SessionID})
+				}
+			}
+		}
+	}
+
+	kept := turns[keepFrom:]
+	report.TurnsKept = len(kept)
+	report.TurnsDropped = len(turns) - len(kept) - report.TurnsSummarized
+
+	history := make([][]string, 0, len(kept)+1)
+	if summary != "" {
+		history = append(history, []string{"system", "Summary of the earlier conversation: " + summary})
+		report.Tokens += countTokens(summary)
+	}
+	for _, t := range kept {
+		history = append(history, []string{t.Role, t.Content})
+		report.Tokens += turnTokens(t)
+	}
+	return newConversationMemory(history), report, nil
+}
+
+// budgetStart returns the index of the oldest turn such that it and every
+// newer turn fit in budget tokens
+func budgetStart(turns []session.Turn, budget int) int {
+	used := 0
+	for i := len(turns) - 1; i >= 0; i-- {
+		used += turnTokens(turns[i])
+		if used > budget {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// summarizeTurns folds turns into summary with the model answering the query
+func (s *Server) summarizeTurns(ctx context.Context, model, summary string, turns []session.Turn) (string, error) {
+	qa, err := s.qaClientsFor(ctx, model)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0, len(turns))
+	for _, t := range turns {
+		lines = append(lines, t.Role+": "+t.Content)
+	}
+	result, err := chains.Predict(ctx, qa.summarize, map[string]any{
+		"summary":   summary,
+		"new_lines": strings.Join(lines, "\n"),
+	}, s.llmCallOptions()...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result), nil
+}
+
+// turnTokens estimates the tokens a turn takes in the prompt, role prefix included
+func turnTokens(t session.Turn) int {
+	return countTokens(t.Role + ": " + t.Content)
+}
+
+var (
+	encoderOnce sync.Once
+	encoder     *tiktoken.Tiktoken
+)
+
+// countTokens counts the tokens of text with tokenEncoding. If the encoding
+// cannot be loaded, for example offline, it assumes four characters per token.
+func countTokens(text string) int {
+	encoderOnce.Do(func() {
+		encoder, _ = tiktoken.GetEncoding(tokenEncoding)
+	})
+	if encoder == nil {
+		return (utf8.RuneCountInString(text) + 3) / 4
+	}
+	return len(encoder.Encode(text, nil, nil))
+}
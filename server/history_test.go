@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/avivnoah/documentation-assistant/pkg/session"
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/memory"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// summarizeChain stands in for the summary chain, recording the lines it folds
+type summarizeChain struct{ calls []string }
+
+func (c *summarizeChain) Call(_ context.Context, inputs map[string]any, _ ...chains.ChainCallOption) (map[string]any, error) {
+	lines := inputs["new_lines"].(string)
+	c.calls = append(c.calls, lines)
+	summary := strings.TrimSpace(fmt.Sprint(inputs["summary"], " ", strings.Count(lines, "\n")+1, " lines"))
+	return map[string]any{"text": summary}, nil
+}
+
+func (c *summarizeChain) GetMemory() schema.Memory { return memory.NewSimple() }
+func (c *summarizeChain) GetInputKeys() []string   { return []string{"summary", "new_lines"} }
+func (c *summarizeChain) GetOutputKeys() []string  { return []string{"text"} }
+
+// testTurns returns n alternating human and ai turns of similar length
+func testTurns(n int) []session.Turn {
+	turns := make([]session.Turn, n)
+	for i := range turns {
+		role := session.RoleHuman
+		if i%2 == 1 {
+			role = session.RoleAI
+		}
+		turns[i] = session.Turn{Role: role, Content: fmt.Sprintf("message number %d about chains", i)}
+	}
+	return turns
+}
+
+// tokensOf returns the tokens the turns take in the prompt
+func tokensOf(turns []session.Turn) int {
+	total := 0
+	for _, t := range turns {
+		total += turnTokens(t)
+	}
+	return total
+}
+
+func TestBudgetStart(t *testing.T) {
+	turns := testTurns(5)
+	tests := []struct {
+		name   string
+		budget int
+		want   int
+	}{
+		{"everything fits", tokensOf(turns), 0},
+		{"last three fit exactly", tokensOf(turns[2:]), 2},
+		{"one token short of three", tokensOf(turns[2:]) - 1, 3},
+		{"nothing fits", 0, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := budgetStart(turns, tt.budget); got != tt.want {
+				t.Errorf("budgetStart = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if got := budgetStart(nil, 10); got != 0 {
+		t.Errorf("budgetStart of no turns = %d, want 0", got)
+	}
+}
+
+func TestConversationMemory(t *testing.T) {
+	turns := testTurns(6)
+	lastThree := tokensOf(turns[3:])
+
+	tests := []struct {
+		name      string
+		req       QueryRequest
+		summary   string // Summary already saved with the session
+		before    int    // Turns that summary covers
+		want      MemoryReport
+		summaries []int  // Lines folded by each summarize call
+		saved     string // Summary saved with the session afterwards
+	}{
+		{
+			name: "full",
+			req:  QueryRequest{MemoryStrategy: MemoryStrategyFull},
+			want: MemoryReport{Strategy: MemoryStrategyFull, TurnsKept: 6},
+		},
+		{
+			name: "last_n",
+			req:  QueryRequest{MemoryStrategy: MemoryStrategyLastN, MemoryTurns: 2},
+			want: MemoryReport{Strategy: MemoryStrategyLastN, TurnsKept: 2, TurnsDropped: 4},
+		},
+		{
+			name: "token_budget",
+			req:  QueryRequest{MemoryStrategy: MemoryStrategyTokenBudget, MemoryTokens: lastThree},
+			want: MemoryReport{Strategy: MemoryStrategyTokenBudget, TurnsKept: 3, TurnsDropped: 3},
+		},
+		{
+			name:      "summary",
+			req:       QueryRequest{MemoryStrategy: MemoryStrategySummary, MemoryTokens: lastThree},
+			want:      MemoryReport{Strategy: MemoryStrategySummary, TurnsKept: 3, TurnsSummarized: 3},
+			summaries: []int{3},
+			saved:     "3 lines",
+		},
+		{
+			name:      "summary extends the saved summary",
+			req:       QueryRequest{MemoryStrategy: MemoryStrategySummary, MemoryTokens: lastThree},
+			summary:   "earlier",
+			before:    2,
+			want:      MemoryReport{Strategy: MemoryStrategySummary, TurnsKept: 3, TurnsSummarized: 3},
+			summaries: []int{1},
+			saved:     "earlier 1 lines",
+		},
+		{
+			name:    "summary still covering the dropped turns",
+			req:     QueryRequest{MemoryStrategy: MemoryStrategySummary, MemoryTokens: lastThree},
+			summary: "earlier",
+			before:  4,
+			want:    MemoryReport{Strategy: MemoryStrategySummary, TurnsKept: 2, TurnsSummarized: 4},
+			saved:   "earlier",
+		},
+		{
+			name:      "summary of another transcript",
+			req:       QueryRequest{MemoryStrategy: MemoryStrategySummary, MemoryTokens: lastThree},
+			summary:   "stale",
+			before:    10,
+			want:      MemoryReport{Strategy: MemoryStrategySummary, TurnsKept: 3, TurnsSummarized: 3},
+			summaries: []int{3},
+			saved:     "3 lines",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestServer(Config{MemoryStrategy: MemoryStrategyFull, MemoryTurns: 10, MemoryTokens: 2000})
+			s.sessions = session.NewMemory()
+			summarize := &summarizeChain{}
+			s.qa = &qaClients{summarize: summarize}
+
+			sess, _ := s.sessions.Create(ctx)
+			s.sessions.Append(ctx, sess.ID, turns...)
+			if tt.summary != "" {
+				s.sessions.SetSummary(ctx, sess.ID, tt.summary, tt.before)
+			}
+			tt.req.SessionID = sess.ID
+
+			buffer, report, err := s.conversationMemory(ctx, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Tokens = report.Tokens
+			if report != tt.want {
+				t.Errorf("report = %+v, want %+v", report, tt.want)
+			}
+
+			if len(summarize.calls) != len(tt.summaries) {
+				t.Fatalf("summarized %d times, want %d", len(summarize.calls), len(tt.summaries))
+			}
+			for i, lines := range tt.summaries {
+				if got := strings.Count(summarize.calls[i], "\n") + 1; got != lines {
+					t.Errorf("call %d folded %d lines, want %d", i, got, lines)
+				}
+			}
+			if saved, _ := s.sessions.Get(ctx, sess.ID); tt.saved != "" && (saved.Summary != tt.saved || saved.SummarizedTurns != tt.want.TurnsSummarized) {
+				t.Errorf("saved summary %q of %d turns, want %q of %d", saved.Summary, saved.SummarizedTurns, tt.saved, tt.want.TurnsSummarized)
+			}
+
+			messages, err := buffer.ChatHistory.Messages(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept := messages
+			if tt.saved != "" {
+				if len(messages) == 0 || messages[0].GetType() != llms.ChatMessageTypeSystem || !strings.HasSuffix(messages[0].GetContent(), tt.saved) {
+					t.Fatalf("first message = %v, want the summary as a system message", messages)
+				}
+				kept = messages[1:]
+			}
+			if len(kept) != tt.want.TurnsKept || kept[len(kept)-1].GetContent() != turns[5].Content {
+				t.Errorf("history = %v, want the newest %d turns", kept, tt.want.TurnsKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avivnoah/documentation-assistant/pkg/ingestion"
+)
+
+// JobState describes where an ingestion job is in the pipeline
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobCrawling  JobState = "crawling"
+	JobSplitting JobState = "splitting"
+	JobEmbedding JobState = "embedding"
+	JobDone      JobState = "done"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+	// JobInterrupted jobs were stopped by a server shutdown and run again on
+	// the next start
+	JobInterrupted JobState = "interrupted"
+)
+
+// Causes of the context of a stopped ingestion job
+var (
+	errJobCancelled   = errors.New("ingestion cancelled")
+	errJobInterrupted = errors.New("ingestion interrupted by server shutdown")
+)
+
+// errIngestionRunning rejects wiping a collection an ingestion job is still
+// writing to
+var errIngestionRunning = errors.New("an ingestion job is running in this collection")
+
+// errCollectionBusy rejects ingesting into, or wiping, a collection that is
+// being reset or deleted
+var errCollectionBusy = errors.New("the collection is being reset or deleted")
+
+// IngestJobStatus is the externally visible snapshot of an ingestion job
+type IngestJobStatus struct {
+	ID            string   `json:"id"`
+	Collection    string   `json:"collection"`
+	URL           string   `json:"url,omitempty"`
+	Path          string   `json:"path,omitempty"`
+	GitURL        string   `json:"git_url,omitempty"`
+	GitRef        string   `json:"git_ref,omitempty"`
+	State         JobState `json:"state"`
+	PagesCrawled  int      `json:"pages_crawled"`
+	ChunksCreated int      `json:"chunks_created"`
+	BatchesStored int      `json:"batches_stored"`
+	BatchesFailed int      `json:"batches_failed"` // Batches given up on after every retry
+	// Result holds the added/updated/unchanged/removed chunk counts once the job ends
+	Result     *ingestion.Result `json:"result,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+// ingestJob tracks the progress of a single background ingestion
+type ingestJob struct {
+	request IngestRequest // Request the job was created from, recorded until it finishes
+
+	source ingestion.Source
+	opts   ingestion.Options
+	base   *knowledgeBase // Collection the source is stored into
+
+	ctx    context.Context // Context the pipeline runs with
+	cancel context.CancelCauseFunc
+	done   chan struct{} // Closed once the job has finished
+
+	mu     sync.Mutex
+	status IngestJobStatus
+}
+
+// setState moves the job to the given pipeline stage
+func (j *ingestJob) setState(state JobState) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.State = state
+	j.status.UpdatedAt = time.Now()
+}
+
+// addPagesCrawled records newly crawled pages
+func (j *ingestJob) addPagesCrawled(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.PagesCrawled += n
+	j.status.UpdatedAt = time.Now()
+}
+
+// addChunksCreated records newly created chunks
+func (j *ingestJob) addChunksCreated(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.ChunksCreated += n
+	j.status.UpdatedAt = time.Now()
+}
+
+// addBatchesStored records batches written to the vector store
+func (j *ingestJob) addBatchesStored(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.BatchesStored += n
+	j.status.UpdatedAt = time.Now()
+}
+
+// addBatchesFailed records batches that could not be stored
+func (j *ingestJob) addBatchesFailed(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.BatchesFailed += n
+	j.status.UpdatedAt = time.Now()
+}
+
+// finish records the pipeline result and marks the job as done, or as failed
+// or cancelled when err is non-nil
+func (j *ingestJob) finish(result ingestion.Result, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.status.Result = &result
+	j.status.State = JobDone
+	switch cause := context.Cause(j.ctx); {
+	case err != nil && (errors.Is(cause, errJobCancelled) || errors.Is(cause, errJobInterrupted)):
+		j.status.State = JobCancelled
+		if errors.Is(cause, errJobInterrupted) {
+			j.status.State = JobInterrupted
+		}
+		j.status.Error = cause.Error()
+	case err != nil:
+		j.status.State = JobFailed
+		j.status.Error = err.Error()
+	}
+	j.status.UpdatedAt = now
+	j.status.FinishedAt = &now
+	j.cancel(nil) // Release the context
+	close(j.done)
+}
+
+// stop cancels the job with cause, errJobCancelled or errJobInterrupted. The
+// crawl stops and the batches being stored are finished; the job is cancelled
+// once they are, which done reports. It returns false when the job had
+// already finished.
+func (j *ingestJob) stop(cause error) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.FinishedAt != nil {
+		return false
+	}
+	j.cancel(cause)
+	return true
+}
+
+// Stage, PagesCrawled, ChunksCreated, BatchStored and BatchFailed implement
+// ingestion.Progress
+func (j *ingestJob) Stage(stage ingestion.Stage) { j.setState(JobState(stage)) }
+func (j *ingestJob) PagesCrawled(n int)          { j.addPagesCrawled(n) }
+func (j *ingestJob) ChunksCreated(n int)         { j.addChunksCreated(n) }
+func (j *ingestJob) BatchStored(int, int)        { j.addBatchesStored(1) }
+func (j *ingestJob) BatchFailed(int, int, error) { j.addBatchesFailed(1) }
+
+// snapshot returns a copy of the current job status
+func (j *ingestJob) snapshot() IngestJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// jobRecord is the file recording an unfinished job, so that a job
+// interrupted by a shutdown or crash is run again on the next start
+type jobRecord struct {
+	ID        string        `json:"id"`
+	Request   IngestRequest `json:"request"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// Finished jobs stay queryable for finishedJobTTL; at most maxFinishedJobs of
+// them are kept, dropping the oldest first
+const (
+	finishedJobTTL  = time.Hour
+	maxFinishedJobs = 100
+)
+
+// jobRegistry keeps the ingestion jobs started by this process: the running
+// ones and the recently finished ones
+type jobRegistry struct {
+	mu     sync.RWMutex
+	jobs   map[string]*ingestJob
+	wiping map[*knowledgeBase]bool // Collections being reset or deleted, which take no new jobs
+	dir    string                  // Directory holding the records of unfinished jobs; empty keeps none
+}
+
+func newJobRegistry(dir string) *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*ingestJob), wiping: make(map[*knowledgeBase]bool), dir: dir}
+}
+
+// create registers a new queued job storing source into base and records it,
+// with its ingestion checkpoint, until it finishes. A non-nil record
+// re-creates an interrupted job under its previous ID, resuming from its
+// checkpoint. It returns errCollectionBusy while base is being wiped.
+func (r *jobRegistry) create(req IngestRequest, source ingestion.Source, opts ingestion.Options, base *knowledgeBase, record *jobRecord) (*ingestJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.wiping[base] {
+		return nil, fmt.Errorf("%w: %s", errCollectionBusy, base.collection.Name)
+	}
+
+	now := time.Now()
+	if record == nil {
+		record = &jobRecord{ID: newJobID(), Request: req, CreatedAt: now}
+	}
+	if err := r.save(*record); err != nil {
+		return nil, fmt.Errorf("failed to record ingestion job: %w", err)
+	}
+	if r.dir != "" {
+		checkpoint, err := ingestion.OpenCheckpoint(r.checkpointDir(record.ID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to record ingestion job: %w", err)
+		}
+		opts.Checkpoint = checkpoint
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	job := &ingestJob{request: req, source: source, opts: opts, base: base, ctx: ctx, cancel: cancel, done: make(chan struct{}), status: IngestJobStatus{
+		ID:         record.ID,
+		Collection: base.collection.Name,
+		URL:        source.URL,
+		Path:       source.Path,
+		GitURL:     source.GitURL,
+		GitRef:     source.GitRef,
+		State:      JobQueued,
+		CreatedAt:  record.CreatedAt,
+		UpdatedAt:  now,
+	}}
+
+	r.prune(now)
+	r.jobs[job.status.ID] = job
+	return job, nil
+}
+
+// prune drops the jobs that finished more than finishedJobTTL ago, then the
+// oldest finished jobs beyond maxFinishedJobs. The caller must hold r.mu.
+func (r *jobRegistry) prune(now time.Time) {
+	type finishedJob struct {
+		id string
+		at time.Time
+	}
+	var finished []finishedJob
+	for id, job := range r.jobs {
+		status := job.snapshot()
+		switch {
+		case status.FinishedAt == nil:
+		case now.Sub(*status.FinishedAt) > finishedJobTTL:
+			delete(r.jobs, id)
+		default:
+			finished = append(finished, finishedJob{id: id, at: *status.FinishedAt})
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	slices.SortFunc(finished, func(a, b finishedJob) int { return a.at.Compare(b.at) })
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(r.jobs, job.id)
+	}
+}
+
+// get looks up a job by ID
+func (r *jobRegistry) get(id string) (*ingestJob, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	job, ok := r.jobs[id]
+	return job, ok
+}
+
+// running returns the jobs that have not finished
+func (r *jobRegistry) running() []*ingestJob {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.runningLocked()
+}
+
+// runningLocked is running for callers holding r.mu
+func (r *jobRegistry) runningLocked() []*ingestJob {
+	var jobs []*ingestJob
+	for _, job := range r.jobs {
+		if job.snapshot().FinishedAt == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// startWipe marks base as being reset or deleted, so that create refuses new
+// jobs storing into it, and returns the function ending the wipe. Checking for
+// running jobs and marking happen under one lock, so no job can start in
+// between. It returns errIngestionRunning while a job storing into base has
+// not finished, and errCollectionBusy while base is already being wiped.
+func (r *jobRegistry) startWipe(base *knowledgeBase) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.wiping[base] {
+		return nil, fmt.Errorf("%w: %s", errCollectionBusy, base.collection.Name)
+	}
+	for _, job := range r.runningLocked() {
+		if job.base == base {
+			return nil, fmt.Errorf("%w: job %s", errIngestionRunning, job.snapshot().ID)
+		}
+	}
+
+	r.wiping[base] = true
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.wiping, base)
+	}, nil
+}
+
+// recordPath returns the file recording the job with the given ID
+func (r *jobRegistry) recordPath(id string) string {
+	return filepath.Join(r.dir, id+".json")
+}
+
+// checkpointDir returns the directory holding the ingestion checkpoint of a job
+func (r *jobRegistry) checkpointDir(id string) string {
+	return filepath.Join(r.dir, id)
+}
+
+// save writes the record of an unfinished job
+func (r *jobRegistry) save(record jobRecord) error {
+	if r.dir == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+	tmp := r.recordPath(record.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.recordPath(record.ID))
+}
+
+// forget removes the record and checkpoint of a finished job
+func (r *jobRegistry) forget(id string) error {
+	if r.dir == "" {
+		return nil
+	}
+	if err := os.Remove(r.recordPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.RemoveAll(r.checkpointDir(id))
+}
+
+// unfinished reads the records of the jobs a previous run did not finish
+func (r *jobRegistry) unfinished() ([]jobRecord, error) {
+	if r.dir == "" {
+		return nil, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]jobRecord, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var record jobRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("invalid job record %s: %w", path, err)
+		}
+		records = append(records, record)
+	}
+	slices.SortFunc(records, func(a, b jobRecord) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return records, nil
+}
+
+// newJobID returns a random, URL-safe job identifier
+func newJobID() string {
+	return strings.ToLower(rand.Text())
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/avivnoah/documentation-assistant/pkg/collection"
+	"github.com/avivnoah/documentation-assistant/pkg/ingestion"
+)
+
+func TestJobRegistryPrunesFinishedJobs(t *testing.T) {
+	jobs := newJobRegistry("")
+	base := &knowledgeBase{collection: collection.Collection{Name: DefaultCollection}}
+	newJob := func() *ingestJob {
+		t.Helper()
+		job, err := jobs.create(IngestRequest{URL: "https://example.com"}, ingestion.Source{URL: "https://example.com"}, ingestion.Options{}, base, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+
+	expired := newJob()
+	expired.finish(ingestion.Result{}, nil)
+	finishedAt := time.Now().Add(-2 * finishedJobTTL)
+	expired.status.FinishedAt = &finishedAt
+
+	running := newJob()
+	var finished []*ingestJob
+	for range maxFinishedJobs + 1 {
+		job := newJob()
+		job.finish(ingestion.Result{}, nil)
+		finished = append(finished, job)
+	}
+	newJob()
+
+	if _, ok := jobs.get(expired.snapshot().ID); ok {
+		t.Error("job finished before the TTL was kept")
+	}
+	if _, ok := jobs.get(running.snapshot().ID); !ok {
+		t.Error("running job was dropped")
+	}
+	if _, ok := jobs.get(finished[0].snapshot().ID); ok {
+		t.Error("oldest finished job beyond the cap was kept")
+	}
+	if _, ok := jobs.get(finished[len(finished)-1].snapshot().ID); !ok {
+		t.Error("latest finished job was dropped")
+	}
+}
+
+func TestJobRegistryWipe(t *testing.T) {
+	jobs := newJobRegistry("")
+	base := &knowledgeBase{collection: collection.Collection{Name: DefaultCollection}}
+	other := &knowledgeBase{collection: collection.Collection{Name: "billing"}}
+	create := func(base *knowledgeBase) (*ingestJob, error) {
+		return jobs.create(IngestRequest{URL: "https://example.com"}, ingestion.Source{URL: "https://example.com"}, ingestion.Options{}, base, nil)
+	}
+
+	endWipe, err := jobs.startWipe(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := create(base); !errors.Is(err, errCollectionBusy) {
+		t.Errorf("creating a job during a wipe: %v, want %v", err, errCollectionBusy)
+	}
+	if _, err := jobs.startWipe(base); !errors.Is(err, errCollectionBusy) {
+		t.Errorf("starting a second wipe: %v, want %v", err, errCollectionBusy)
+	}
+	if _, err := create(other); err != nil {
+		t.Errorf("creating a job in another collection during a wipe: %v", err)
+	}
+	endWipe()
+
+	job, err := create(base)
+	if err != nil {
+		t.Fatalf("creating a job after the wipe: %v", err)
+	}
+	if _, err := jobs.startWipe(base); !errors.Is(err, errIngestionRunning) {
+		t.Errorf("wiping with a running job: %v, want %v", err, errIngestionRunning)
+	}
+	job.finish(ingestion.Result{}, nil)
+	endWipe, err = jobs.startWipe(base)
+	if err != nil {
+		t.Fatalf("wiping once the job finished: %v", err)
+	}
+	endWipe()
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/avivnoah/documentation-assistant/pkg/ingestion"
+	"github.com/avivnoah/documentation-assistant/prompt"
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/googleai"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+	"github.com/tmc/langchaingo/prompts"
+)
+
+// Model providers accepted in Config.LLMProvider and Config.EmbeddingProvider
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+	ProviderOllama = "ollama"
+)
+
+// newLLM creates a chat model client. An empty model selects the provider's
+// default model and baseURL, when set, points the client at a self-hosted or
+// OpenAI-compatible server instead of the provider's public API.
+func newLLM(ctx context.Context, provider, model, baseURL string) (llms.Model, error) {
+	switch provider {
+	case ProviderGemini:
+		opts := []googleai.Option{}
+		if model != "" {
+			opts = append(opts, googleai.WithDefaultModel(model))
+		}
+		return googleai.New(ctx, opts...)
+	case ProviderOpenAI:
+		opts := openAIOptions(baseURL)
+		if model != "" {
+			opts = append(opts, openai.WithModel(model))
+		}
+		return openai.New(opts...)
+	case ProviderOllama:
+		opts := []ollama.Option{ollama.WithModel(model)}
+		if baseURL != "" {
+			opts = append(opts, ollama.WithServerURL(baseURL))
+		}
+		return ollama.New(opts...)
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", provider)
+	}
+}
+
+// qaClients holds an LLM and the stateless chains built on it. They are
+// created once and shared by every request; per-request state such as memory
+// lives in the ConversationalRetrievalQA built by runLLM.
+type qaClients struct {
+	llm       llms.Model
+	stuff     numberedStuffDocuments
+	condense  chains.Chain
+	summarize chains.Chain // Folds older chat turns into a running summary
+}
+
+// qaTemplates are the prompt templates the QA chains are built from
+type qaTemplates struct {
+	rag      string // Answers from the retrieved chunks, see prompt.RAG_PROMPT
+	rephrase string // Condenses a follow up question, see prompt.REPHRASE_PROMPT
+}
+
+// loadQATemplates reads the templates configured in config, falling back to
+// the prompt package defaults
+func loadQATemplates(config Config) (qaTemplates, error) {
+	rag, err := prompt.Load(config.RAGPromptFile, prompt.RAG_PROMPT, prompt.RAGVariables)
+	if err != nil {
+		return qaTemplates{}, err
+	}
+	rephrase, err := prompt.Load(config.RephrasePromptFile, prompt.REPHRASE_PROMPT, prompt.RephraseVariables)
+	if err != nil {
+		return qaTemplates{}, err
+	}
+	return qaTemplates{rag: rag, rephrase: rephrase}, nil
+}
+
+func newQAClients(ctx context.Context, provider, model, baseURL string, templates qaTemplates) (*qaClients, error) {
+	llm, err := newLLM(ctx, provider, model, baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	ragPrompt := prompts.NewPromptTemplate(templates.rag, prompt.RAGVariables)
+	rephrasePrompt := prompts.NewPromptTemplate(templates.rephrase, prompt.RephraseVariables)
+	summaryPrompt := prompts.NewPromptTemplate(prompt.SUMMARY_PROMPT, prompt.SummaryVariables)
+	return &qaClients{
+		llm:       llm,
+		stuff:     numberedStuffDocuments{StuffDocuments: chains.NewStuffDocuments(chains.NewLLMChain(llm, ragPrompt))},
+		condense:  chains.NewLLMChain(llm, rephrasePrompt),
+		summarize: chains.NewLLMChain(llm, summaryPrompt),
+	}, nil
+}
+
+// errUnknownModel rejects queries asking for a model outside Config.LLMModels
+var errUnknownModel = errors.New("model is not allowed")
+
+// validateModel accepts the empty default, the configured model and the ones
+// listed in Config.LLMModels, which bounds the clients qaClientsFor caches
+func (s *Server) validateModel(model string) error {
+	if model == "" || model == s.config.LLMModel || slices.Contains(s.config.LLMModels, model) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q", errUnknownModel, model)
+}
+
+// qaClientsFor returns the clients for model, creating and caching them on first
+// use. An empty model, or the configured one, returns the clients built at startup.
+func (s *Server) qaClientsFor(ctx context.Context, model string) (*qaClients, error) {
+	if err := s.validateModel(model); err != nil {
+		return nil, err
+	}
+	if model == "" || model == s.config.LLMModel {
+		return s.qa, nil
+	}
+
+	s.qaMu.Lock()
+	defer s.qaMu.Unlock()
+	if clients, ok := s.qaOverrides[model]; ok {
+		return clients, nil
+	}
+
+	// The clients outlive the request, so they must not be bound to its deadline
+	clients, err := newQAClients(context.WithoutCancel(ctx), s.config.LLMProvider, model, s.config.LLMBaseURL, s.templates)
+	if err != nil {
+		return nil, err
+	}
+	s.qaOverrides[model] = clients
+	return clients, nil
+}
+
+// newEmbedder creates the embedder used to vectorize documents and queries
+func newEmbedder(ctx context.Context, provider, model, baseURL string) (embeddings.Embedder, error) {
+	var client embeddings.EmbedderClient
+	var err error
+	// Reports 429 responses and their Retry-After to the ingestion store. The
+	// Gemini client takes no HTTP client with its API key, so its rate limits
+	// are only recognized from the error message.
+	httpClient := &http.Client{Transport: ingestion.RateLimitTransport{}}
+
+	switch provider {
+	case ProviderOpenAI:
+		opts := append(openAIOptions(baseURL), openai.WithHTTPClient(httpClient))
+		if model != "" {
+			opts = append(opts, openai.WithEmbeddingModel(model))
+		}
+		client, err = openai.New(opts...)
+	case ProviderGemini:
+		opts := []googleai.Option{}
+		if model != "" {
+			opts = append(opts, googleai.WithDefaultEmbeddingModel(model))
+		}
+		client, err = googleai.New(ctx, opts...)
+	case ProviderOllama:
+		opts := []ollama.Option{ollama.WithModel(model), ollama.WithHTTPClient(httpClient)}
+		if baseURL != "" {
+			opts = append(opts, ollama.WithServerURL(baseURL))
+		}
+		client, err = ollama.New(opts...)
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return embeddings.NewEmbedder(client,
+		embeddings.WithBatchSize(50),
+		embeddings.WithStripNewLines(true))
+}
+
+// openAIOptions points the OpenAI client at baseURL. Local OpenAI-compatible
+// servers usually ignore the API key, so a placeholder is used when none is set.
+func openAIOptions(baseURL string) []openai.Option {
+	if baseURL == "" {
+		return nil
+	}
+	opts := []openai.Option{openai.WithBaseURL(baseURL)}
+	if os.Getenv("OPENAI_API_KEY") == "" {
+		opts = append(opts, openai.WithToken("unused"))
+	}
+	return opts
+}
+
+// llmCallOptions returns the generation settings from the server configuration
+func (s *Server) llmCallOptions() []chains.ChainCallOption {
+	var opts []chains.ChainCallOption
+	if s.config.LLMTemperature != nil {
+		opts = append(opts, chains.WithTemperature(*s.config.LLMTemperature))
+	}
+	if s.config.LLMMaxTokens > 0 {
+		opts = append(opts, chains.WithMaxTokens(s.config.LLMMaxTokens))
+	}
+	return opts
+}
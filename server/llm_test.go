@@ -0,0 +1,21 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestValidateModel(t *testing.T) {
+	s := &Server{config: Config{LLMModel: "gemini-2.5-flash", LLMModels: []string{"gemini-2.5-pro"}}}
+
+	for _, model := range []string{"", "gemini-2.5-flash", "gemini-2.5-pro"} {
+		if err := s.validateModel(model); err != nil {
+			t.Errorf("validateModel(%q) = %v, want nil", model, err)
+		}
+	}
+	err := s.validateModel("gemini-ultra")
+	if !errors.Is(err, errUnknownModel) || requestErrorStatus(err) != http.StatusBadRequest {
+		t.Errorf("validateModel of an unlisted model = %v, want a 400 errUnknownModel", err)
+	}
+}
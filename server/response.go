@@ -0,0 +1,116 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/avivnoah/documentation-assistant/pkg/rerank"
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// QueryResponseVersion identifies the shape of QueryResponse and of the
+// streaming events. It is bumped whenever a field is removed or changes
+// meaning; new optional fields do not change it. Version 1 was the untyped
+// result/source_documents response.
+const QueryResponseVersion = 2
+
+// snippetLength is the maximum number of characters of a chunk returned as snippet
+const snippetLength = 300
+
+// QueryResponse is the answer to a QueryRequest
+type QueryResponse struct {
+	Version int           `json:"version"`
+	Query   string        `json:"query"`
+	Answer  string        `json:"answer"`
+	Sources []QuerySource `json:"sources"`
+	// Citations lists the sources cited inline in Answer, once each, in order
+	// of first appearance. InvalidCitations are the cited numbers that match no
+	// source; they have been removed from Answer.
+	Citations        []Citation   `json:"citations"`
+	InvalidCitations []int        `json:"invalid_citations,omitempty"`
+	SessionID        string       `json:"session_id,omitempty"` // Session the turn was appended to
+	Memory           MemoryReport `json:"memory"`               // How the chat history was trimmed
+	RetrievalMode    string       `json:"retrieval_mode"`       // How the sources were found
+	Rerank           string       `json:"rerank"`               // How the sources were re-ranked
+	Collection       string       `json:"collection"`           // Collection the sources come from
+	Error            string       `json:"error,omitempty"`
+}
+
+// QuerySource describes one retrieved chunk the answer was generated from
+type QuerySource struct {
+	Number  int     `json:"number"`            // Label of the chunk in the prompt; [n] in the answer cites it
+	URL     string  `json:"url"`               // Page URL (with the section anchor when known) or file path
+	Title   string  `json:"title,omitempty"`   // Page title
+	Section string  `json:"section,omitempty"` // Heading path of the chunk, e.g. "Guide > Install"
+	Snippet string  `json:"snippet"`           // Beginning of the chunk text
+	Score   float32 `json:"score"`             // Relevance to the question, higher is closer; see RetrievalMode
+	// RerankScore is the score given by the reranker, from 0 to 1, when one ran
+	RerankScore *float64 `json:"rerank_score,omitempty"`
+	ChunkID     string   `json:"chunk_id,omitempty"`
+}
+
+// newQuerySources converts retrieved documents into the public source schema
+func newQuerySources(docs []schema.Document) []QuerySource {
+	sources := make([]QuerySource, 0, len(docs))
+	for i, doc := range docs {
+		source := QuerySource{
+			Number:  i + 1,
+			URL:     sourceURL(doc.Metadata),
+			Title:   metadataString(doc.Metadata, "title"),
+			Section: metadataString(doc.Metadata, "heading_path"),
+			Snippet: snippet(doc.PageContent),
+			Score:   doc.Score,
+			ChunkID: metadataString(doc.Metadata, vectorstore.ChunkIDKey),
+		}
+		if score, ok := doc.Metadata[rerank.ScoreKey].(float64); ok {
+			source.RerankScore = &score
+		}
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// newQueryResponse builds the response for an answer generated from docs,
+// resolving the answer's inline citations
+func newQueryResponse(query, answer string, docs []schema.Document) QueryResponse {
+	sources := newQuerySources(docs)
+	answer, citations, invalid := resolveCitations(answer, sources)
+	if citations == nil {
+		citations = []Citation{}
+	}
+	return QueryResponse{
+		Version:          QueryResponseVersion,
+		Query:            query,
+		Answer:           answer,
+		Sources:          sources,
+		Citations:        citations,
+		InvalidCitations: invalid,
+	}
+}
+
+// sourceURL links web pages to the chunk's section. Files of git
+// repositories, whose source is not a page URL, are left as they are.
+func sourceURL(metadata map[string]any) string {
+	source := metadataString(metadata, "source")
+	anchor := metadataString(metadata, "anchor")
+	isWeb := (strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")) && metadata["repo"] == nil
+	if anchor != "" && isWeb && !strings.Contains(source, "#") {
+		return source + "#" + anchor
+	}
+	return source
+}
+
+func metadataString(metadata map[string]any, key string) string {
+	s, _ := metadata[key].(string)
+	return s
+}
+
+// snippet returns the start of text with whitespace collapsed
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= snippetLength {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:snippetLength])) + "…"
+}
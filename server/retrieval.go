@@ -0,0 +1,231 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/avivnoah/documentation-assistant/pkg/keyword"
+	"github.com/avivnoah/documentation-assistant/pkg/rerank"
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// Retrieval modes accepted in QueryRequest.RetrievalMode and Config.RetrievalMode
+const (
+	RetrievalVector  = "vector"  // Dense similarity search in the vector store
+	RetrievalKeyword = "keyword" // BM25 search in the keyword index
+	RetrievalHybrid  = "hybrid"  // Both, fused with reciprocal rank fusion
+)
+
+// Rerankers accepted in QueryRequest.Rerank and Config.Reranker
+const (
+	RerankNone    = "none"    // Keep the retrieval order
+	RerankLexical = "lexical" // rerank.Lexical, query term overlap
+	RerankLLM     = "llm"     // rerank.LLM, ratings by the chat model
+)
+
+// rerankCandidatesFactor sets how many candidates are re-ranked per requested
+// chunk when Config.RerankCandidates is unset
+const rerankCandidatesFactor = 4
+
+// rrfK dampens the weight of the top ranks in reciprocal rank fusion; 60 is
+// the value from the original paper and works well without tuning
+const rrfK = 60
+
+// Errors rejecting queries that ask for a retrieval mode or reranker that does not exist
+var (
+	errUnknownRetrievalMode = errors.New("unknown retrieval mode")
+	errUnknownReranker      = errors.New("unknown reranker")
+)
+
+// retrievalOptions selects how the chunks answering a query are found
+type retrievalOptions struct {
+	NumDocs int
+	Mode    string         // One of the Retrieval* modes
+	Rerank  string         // One of the Rerank* rerankers
+	Filter  map[string]any // Metadata filter in Pinecone's syntax; nil matches every chunk
+
+	base *knowledgeBase // Collection to search
+}
+
+// validateRetrievalMode accepts the Retrieval* modes and the empty default
+func validateRetrievalMode(mode string) error {
+	switch mode {
+	case "", RetrievalVector, RetrievalKeyword, RetrievalHybrid:
+		return nil
+	default:
+		return fmt.Errorf("%w %q", errUnknownRetrievalMode, mode)
+	}
+}
+
+// validateReranker accepts the Rerank* rerankers and the empty default
+func validateReranker(reranker string) error {
+	switch reranker {
+	case "", RerankNone, RerankLexical, RerankLLM:
+		return nil
+	default:
+		return fmt.Errorf("%w %q", errUnknownReranker, reranker)
+	}
+}
+
+// retrievalOptions returns the retrieval settings of req, falling back to the
+// server configuration
+func (s *Server) retrievalOptions(ctx context.Context, req QueryRequest) (retrievalOptions, error) {
+	if err := validateRetrievalMode(req.RetrievalMode); err != nil {
+		return retrievalOptions{}, err
+	}
+	if err := validateReranker(req.Rerank); err != nil {
+		return retrievalOptions{}, err
+	}
+	filter, err := req.Filters.metadataFilter()
+	if err != nil {
+		return retrievalOptions{}, err
+	}
+	base, err := s.knowledgeBase(ctx, req.Collection)
+	if err != nil {
+		return retrievalOptions{}, err
+	}
+	return retrievalOptions{
+		NumDocs: req.NumDocs,
+		Mode:    cmp.Or(req.RetrievalMode, s.config.RetrievalMode),
+		Rerank:  cmp.Or(req.Rerank, s.config.Reranker),
+		Filter:  filter,
+		base:    base,
+	}, nil
+}
+
+// retriever returns the retriever for opts. The LLM reranker rates chunks
+// with the model of qa.
+func (s *Server) retriever(opts retrievalOptions, qa *qaClients) schema.Retriever {
+	var reranker rerank.Reranker
+	switch opts.Rerank {
+	case RerankLexical:
+		reranker = rerank.Lexical{}
+	case RerankLLM:
+		reranker = rerank.NewLLM(qa.llm)
+	}
+
+	numDocs := opts.NumDocs
+	if reranker != nil {
+		numDocs = max(cmp.Or(s.config.RerankCandidates, rerankCandidatesFactor*opts.NumDocs), opts.NumDocs)
+	}
+
+	var searchOptions []vectorstores.Option
+	if opts.Filter != nil {
+		searchOptions = append(searchOptions, vectorstores.WithFilters(opts.Filter))
+	}
+
+	var retriever schema.Retriever
+	switch opts.Mode {
+	case RetrievalKeyword:
+		retriever = keywordRetriever{index: opts.base.keywords, numDocs: numDocs, filter: opts.Filter}
+	case RetrievalHybrid:
+		// Fetch more candidates than needed from both sides so that chunks
+		// ranked moderately by both can outrank chunks found by one only
+		candidates := 2 * numDocs
+		retriever = hybridRetriever{
+			retrievers: []schema.Retriever{
+				vectorstores.ToRetriever(opts.base.store, candidates, searchOptions...),
+				keywordRetriever{index: opts.base.keywords, numDocs: candidates, filter: opts.Filter},
+			},
+			numDocs: numDocs,
+		}
+	default:
+		retriever = vectorstores.ToRetriever(opts.base.store, numDocs, searchOptions...)
+	}
+
+	if reranker == nil {
+		return retriever
+	}
+	return rerankingRetriever{Retriever: retriever, reranker: reranker, numDocs: opts.NumDocs}
+}
+
+// rerankingRetriever re-scores the candidates of a retriever and keeps the
+// numDocs best
+type rerankingRetriever struct {
+	schema.Retriever
+	reranker rerank.Reranker
+	numDocs  int
+}
+
+func (r rerankingRetriever) GetRelevantDocuments(ctx context.Context, query string) ([]schema.Document, error) {
+	docs, err := r.Retriever.GetRelevantDocuments(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return rerank.Rerank(ctx, r.reranker, query, docs, r.numDocs)
+}
+
+// keywordRetriever searches the BM25 keyword index
+type keywordRetriever struct {
+	index   *keyword.Index
+	numDocs int
+	filter  map[string]any
+}
+
+func (r keywordRetriever) GetRelevantDocuments(ctx context.Context, query string) ([]schema.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.index.Search(query, r.numDocs, r.filter), nil
+}
+
+// hybridRetriever merges the rankings of several retrievers with reciprocal
+// rank fusion. The Score of the returned documents is their fused score.
+type hybridRetriever struct {
+	retrievers []schema.Retriever
+	numDocs    int
+}
+
+func (r hybridRetriever) GetRelevantDocuments(ctx context.Context, query string) ([]schema.Document, error) {
+	rankings := make([][]schema.Document, 0, len(r.retrievers))
+	for _, retriever := range r.retrievers {
+		docs, err := retriever.GetRelevantDocuments(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		rankings = append(rankings, docs)
+	}
+	return fuseRankings(rankings, r.numDocs), nil
+}
+
+// fuseRankings scores every document with the sum of 1/(rrfK+rank) over the
+// rankings it appears in and returns the numDocs best. A document found by
+// several rankings keeps the metadata of the first one.
+func fuseRankings(rankings [][]schema.Document, numDocs int) []schema.Document {
+	var fused []schema.Document
+	scores := map[string]float64{}
+	positions := map[string]int{}
+	for _, ranking := range rankings {
+		for rank, doc := range ranking {
+			key := fusionKey(doc)
+			if _, ok := positions[key]; !ok {
+				positions[key] = len(fused)
+				fused = append(fused, doc)
+			}
+			scores[key] += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	for i := range fused {
+		fused[i].Score = float32(scores[fusionKey(fused[i])])
+	}
+	sort.SliceStable(fused, func(i, j int) bool { return fused[i].Score > fused[j].Score })
+	if len(fused) > numDocs {
+		fused = fused[:numDocs]
+	}
+	return fused
+}
+
+// fusionKey identifies a chunk across retrievers: its chunk ID, or its source
+// and text for chunks stored without one
+func fusionKey(doc schema.Document) string {
+	if id := metadataString(doc.Metadata, vectorstore.ChunkIDKey); id != "" {
+		return id
+	}
+	return metadataString(doc.Metadata, "source") + "\x00" + doc.PageContent
+}
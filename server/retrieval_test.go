@@ -0,0 +1,44 @@
+package server
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// rankedDoc is a retrieved chunk with an ID and the retriever that found it
+func rankedDoc(id, retriever string) schema.Document {
+	return schema.Document{PageContent: id, Metadata: map[string]any{vectorstore.ChunkIDKey: id, "retriever": retriever}}
+}
+
+func TestFuseRankings(t *testing.T) {
+	vector := []schema.Document{rankedDoc("a", "vector"), rankedDoc("b", "vector"), rankedDoc("c", "vector")}
+	keyword := []schema.Document{rankedDoc("c", "keyword"), rankedDoc("d", "keyword"), rankedDoc("a", "keyword")}
+
+	fused := fuseRankings([][]schema.Document{vector, keyword}, 3)
+	var got []string
+	for _, doc := range fused {
+		got = append(got, doc.PageContent)
+	}
+	// a: 1/61 + 1/63, c: 1/63 + 1/61, b: 1/62, d: 1/62; ties keep first-seen order
+	if want := []string{"a", "c", "b"}; !slices.Equal(got, want) {
+		t.Fatalf("fused ranking = %v, want %v", got, want)
+	}
+	if want := float32(1.0/(rrfK+1) + 1.0/(rrfK+3)); fused[0].Score != want {
+		t.Errorf("score of a = %v, want %v", fused[0].Score, want)
+	}
+	if fused[1].Metadata["retriever"] != "vector" {
+		t.Errorf("c kept the metadata of the %v ranking, want the first one", fused[1].Metadata["retriever"])
+	}
+
+	// Chunks stored without an ID are matched by source and text
+	withoutID := func(text string) schema.Document {
+		return schema.Document{PageContent: text, Metadata: map[string]any{"source": "https://example.com"}}
+	}
+	fused = fuseRankings([][]schema.Document{{withoutID("x"), withoutID("y")}, {withoutID("y")}}, 5)
+	if len(fused) != 2 || fused[0].PageContent != "y" {
+		t.Errorf("fused = %v, want y, found by both rankings, first", fused)
+	}
+}
@@ -5,93 +5,357 @@ import (
 	"fmt"
 	"logging"
 	"net/http"
-
-	"github.com/tmc/langchaingo/embeddings"
-	"github.com/tmc/langchaingo/llms/openai"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/avivnoah/documentation-assistant/pkg/collection"
+	ingestion "github.com/avivnoah/documentation-assistant/pkg/ingestion"
+	"github.com/avivnoah/documentation-assistant/pkg/session"
+	"github.com/avivnoah/documentation-assistant/pkg/vectorstore"
 	"github.com/tmc/langchaingo/vectorstores"
-	"github.com/tmc/langchaingo/vectorstores/pinecone"
 )
 
 type Server struct {
-	store  vectorstores.VectorStore
-	logger logging.Logger
-	port   string
+	logger   logging.Logger
+	port     string
+	jobs     *jobRegistry
+	config   Config
+	sessions session.Store // Server-side conversations
+
+	collections *collection.Registry      // Collections created through the API
+	bases       map[string]*knowledgeBase // Opened collections by name
+	basesMu     sync.Mutex
+
+	templates   qaTemplates
+	qa          *qaClients            // LLM and chains for the configured model
+	qaOverrides map[string]*qaClients // Lazily created clients for per-request model overrides
+	qaMu        sync.Mutex
 }
 
+// defaultShutdownTimeout is how long a shutdown waits for requests and ingestions
+const defaultShutdownTimeout = 30 * time.Second
+
+// Vector store providers accepted in Config.VectorStore
+const (
+	VectorStorePinecone = "pinecone"
+	VectorStoreMemory   = "memory"
+	VectorStoreLocal    = "local"
+)
+
 type Config struct {
-	PineconeHost string
-	Port         string
+	VectorStore       string // One of the VectorStore* providers, defaults to pinecone
+	LocalStorePath    string // File used by the local vector store
+	ManifestPath      string // File recording ingested chunks; unused by the memory store
+	KeywordIndexPath  string // File holding the BM25 keyword index; unused by the memory store
+	CollectionsDir    string // Directory holding the collection registry and the files of created collections
+	RetrievalMode     string // One of the Retrieval* modes, defaults to vector
+	Reranker          string // One of the Rerank* rerankers, defaults to none
+	RerankCandidates  int    // Candidates fetched for re-ranking; zero fetches 4 per requested chunk
+	PineconeHost      string
+	PineconeNamespace string
+	Port              string
+	IngestRoot        string // Directory local path ingestion is confined to; empty disables it
+	WebCrawler        string // One of the ingestion.WebCrawler* crawlers; empty picks Tavily when TAVILY_API_KEY is set
+	SessionStore      string // One of the SessionStore* stores, defaults to memory
+	SessionDir        string // Directory used by the file session store
+	JobsDir           string // Directory recording unfinished ingestion jobs; unused by the memory store
+
+	// ShutdownTimeout is how long in-flight requests and running ingestions
+	// get to finish on shutdown, defaults to 30s. Ingestions still running
+	// then are stopped and run again on the next start.
+	ShutdownTimeout time.Duration
+
+	LLMProvider    string   // One of the Provider* constants, defaults to gemini
+	LLMModel       string   // Empty selects the provider's default model
+	LLMModels      []string // Other models a request may pick with "model"; none by default
+	LLMBaseURL     string   // Optional self-hosted or OpenAI-compatible endpoint
+	LLMTemperature *float64 // Nil keeps the provider's default
+	LLMMaxTokens   int      // Zero keeps the provider's default
+
+	MemoryStrategy string // One of the MemoryStrategy* strategies, defaults to full
+	MemoryTurns    int    // Turns kept by the last_n strategy, defaults to 10
+	MemoryTokens   int    // Token budget of the token_budget and summary strategies, defaults to 2000
+
+	QueryTimeout time.Duration // Deadline of a query without timeout_ms, defaults to 50s
+
+	RAGPromptFile      string // Optional template replacing prompt.RAG_PROMPT
+	RephrasePromptFile string // Optional template replacing prompt.REPHRASE_PROMPT
+
+	EmbeddingProvider string // One of the Provider* constants, defaults to openai
+	EmbeddingModel    string // Defaults to text-embedding-3-small for openai
+	EmbeddingBaseURL  string // Optional self-hosted or OpenAI-compatible endpoint
 }
 
 // NewServer creates and initializes a new server instance
 func NewServer(ctx context.Context, logger logging.Logger, config Config) (*Server, error) {
-	store, err := initializeVectorStore(ctx, logger, config.PineconeHost)
+	if config.VectorStore == "" {
+		config.VectorStore = VectorStorePinecone
+	}
+	if config.LocalStorePath == "" {
+		config.LocalStorePath = "data/vectorstore.json"
+	}
+	if config.ManifestPath == "" {
+		config.ManifestPath = "data/manifest.json"
+	}
+	if config.KeywordIndexPath == "" {
+		config.KeywordIndexPath = "data/keywords.json"
+	}
+	if config.CollectionsDir == "" {
+		config.CollectionsDir = "data/collections"
+	}
+	if config.RetrievalMode == "" {
+		config.RetrievalMode = RetrievalVector
+	}
+	if err := validateRetrievalMode(config.RetrievalMode); err != nil {
+		return nil, err
+	}
+	if config.Reranker == "" {
+		config.Reranker = RerankNone
+	}
+	if err := validateReranker(config.Reranker); err != nil {
+		return nil, err
+	}
+	if config.SessionStore == "" {
+		config.SessionStore = SessionStoreMemory
+	}
+	if config.SessionDir == "" {
+		config.SessionDir = "data/sessions"
+	}
+	if config.JobsDir == "" {
+		config.JobsDir = "data/jobs"
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if config.PineconeNamespace == "" {
+		config.PineconeNamespace = "lc-docs-ns"
+	}
+	if config.LLMProvider == "" {
+		config.LLMProvider = ProviderGemini
+	}
+	if config.EmbeddingProvider == "" {
+		config.EmbeddingProvider = ProviderOpenAI
+	}
+	if config.EmbeddingProvider == ProviderOpenAI && config.EmbeddingModel == "" {
+		config.EmbeddingModel = "text-embedding-3-small"
+	}
+	if config.QueryTimeout <= 0 {
+		config.QueryTimeout = defaultQueryTimeout
+	}
+	if config.MemoryStrategy == "" {
+		config.MemoryStrategy = MemoryStrategyFull
+	}
+	if config.MemoryTurns <= 0 {
+		config.MemoryTurns = defaultMemoryTurns
+	}
+	if config.MemoryTokens <= 0 {
+		config.MemoryTokens = defaultMemoryTokens
+	}
+	if err := validateMemoryStrategy(config.MemoryStrategy); err != nil {
+		return nil, err
+	}
+	switch config.WebCrawler {
+	case "", ingestion.WebCrawlerTavily, ingestion.WebCrawlerNative:
+	default:
+		return nil, fmt.Errorf("unknown web crawler %q", config.WebCrawler)
+	}
+
+	// Collections and unfinished jobs, like the vectors, only outlive the
+	// process with a persistent store
+	collections := collection.NewRegistry()
+	jobsDir := ""
+	if config.VectorStore != VectorStoreMemory {
+		jobsDir = config.JobsDir
+		var err error
+		collections, err = collection.OpenRegistry(filepath.Join(config.CollectionsDir, "collections.json"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sessions, err := newSessionStore(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize vector store: %w", err)
+		return nil, err
 	}
 
 	if config.Port == "" {
 		config.Port = "8080"
 	}
 
-	return &Server{
-		store:  store,
-		logger: logger,
-		port:   config.Port,
-	}, nil
-}
-
-// initializeVectorStore creates and configures the Pinecone vector store
-func initializeVectorStore(ctx context.Context, logger logging.Logger, pineconeHost string) (vectorstores.VectorStore, error) {
-	if pineconeHost == "" {
-		return nil, fmt.Errorf("PINECONE_HOST environment variable not set")
+	templates, err := loadQATemplates(config)
+	if err != nil {
+		return nil, err
 	}
 
-	llm, err := openai.New(openai.WithEmbeddingModel("text-embedding-3-small"))
+	qa, err := newQAClients(ctx, config.LLMProvider, config.LLMModel, config.LLMBaseURL, templates)
 	if err != nil {
-		logger.Error(ctx, "Failed to initialize OpenAI LLM", map[string]any{"error": err.Error()})
+		logger.Error(ctx, "Failed to initialize LLM", map[string]any{"error": err.Error(), "provider": config.LLMProvider, "model": config.LLMModel})
+		return nil, fmt.Errorf("failed to initialize LLM: %w", err)
+	}
+
+	s := &Server{
+		logger:   logger,
+		port:     config.Port,
+		jobs:     newJobRegistry(jobsDir),
+		config:   config,
+		sessions: sessions,
+
+		collections: collections,
+		bases:       make(map[string]*knowledgeBase),
+
+		templates:   templates,
+		qa:          qa,
+		qaOverrides: make(map[string]*qaClients),
+	}
+
+	// Open the default collection now so configuration errors stop the server at startup
+	if _, err := s.knowledgeBase(ctx, DefaultCollection); err != nil {
 		return nil, err
 	}
+	return s, nil
+}
 
-	embedder, err := embeddings.NewEmbedder(llm,
-		embeddings.WithBatchSize(50),
-		embeddings.WithStripNewLines(true))
+// initializeVectorStore creates the vector store of collection c with the
+// provider selected by config.VectorStore. The local store is saved at path.
+func initializeVectorStore(ctx context.Context, logger logging.Logger, config Config, c collection.Collection, path string) (vectorstores.VectorStore, error) {
+	switch config.VectorStore {
+	case VectorStorePinecone, VectorStoreMemory, VectorStoreLocal:
+	default:
+		return nil, fmt.Errorf("unknown vector store %q", config.VectorStore)
+	}
+	if config.VectorStore == VectorStorePinecone && config.PineconeHost == "" {
+		return nil, fmt.Errorf("PINECONE_HOST environment variable not set")
+	}
+
+	embedder, err := newEmbedder(ctx, c.EmbeddingProvider, c.EmbeddingModel, embeddingBaseURL(config, c))
 	if err != nil {
-		logger.Error(ctx, "Failed to create embedder", map[string]any{"error": err.Error()})
+		logger.Error(ctx, "Failed to create embedder", map[string]any{"error": err.Error(), "provider": c.EmbeddingProvider, "collection": c.Name})
 		return nil, err
 	}
 
-	store, err := pinecone.New(
-		pinecone.WithHost(pineconeHost),
-		pinecone.WithEmbedder(embedder),
-		pinecone.WithNameSpace("lc-docs-ns"),
-	)
+	var store vectorstore.Store
+	switch config.VectorStore {
+	case VectorStoreMemory:
+		store = vectorstore.NewMemory(embedder)
+	case VectorStoreLocal:
+		store, err = vectorstore.NewLocal(path, embedder)
+	default:
+		store, err = vectorstore.NewPinecone(config.PineconeHost, c.Namespace, embedder)
+	}
 	if err != nil {
-		logger.Error(ctx, "Failed to create Pinecone vector store", map[string]any{"error": err.Error()})
+		logger.Error(ctx, "Failed to create vector store", map[string]any{"error": err.Error(), "provider": config.VectorStore})
 		return nil, err
 	}
 
-	logger.Info(ctx, "Vector store initialized successfully", map[string]any{"host": pineconeHost})
+	logger.Info(ctx, "Vector store initialized successfully", map[string]any{
+		"provider":   config.VectorStore,
+		"collection": c.Name,
+		"host":       config.PineconeHost,
+		"namespace":  c.Namespace,
+		"path":       path,
+	})
 	return store, nil
 }
 
-// Start begins listening for HTTP requests
+// Start resumes the ingestion jobs a previous run did not finish and serves
+// HTTP requests until ctx is cancelled, then shuts down gracefully
 func (s *Server) Start(ctx context.Context) error {
-	s.registerHandlers()
+	mux := http.NewServeMux()
+	s.registerHandlers(mux)
 	s.logServerInfo(ctx)
+	s.resumeJobs(ctx)
 
-	if err := http.ListenAndServe(":"+s.port, nil); err != nil {
+	httpServer := &http.Server{Addr: ":" + s.port, Handler: mux}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- httpServer.ListenAndServe() }()
+
+	select {
+	case err := <-serveErr:
 		s.logger.Error(ctx, "Server failed", map[string]any{"error": err.Error()})
 		return err
+	case <-ctx.Done():
+	}
+	return s.shutdown(httpServer)
+}
+
+// shutdown stops accepting requests and gives in-flight requests and running
+// ingestions ShutdownTimeout to finish. Requests still running are then
+// closed, and ingestions are stopped once the batches being stored are
+// written; they stay recorded so the next start runs them again.
+func (s *Server) shutdown(httpServer *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+	jobs := s.jobs.running()
+	s.logger.Info(ctx, "Shutting down", map[string]any{"timeout": s.config.ShutdownTimeout.String(), "running_jobs": len(jobs)})
+
+	var wg sync.WaitGroup
+	var shutdownErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			s.logger.Error(ctx, "In-flight requests did not finish in time", map[string]any{"error": err.Error()})
+			shutdownErr = httpServer.Close()
+		}
+	}()
+	for _, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-job.done:
+				return
+			case <-ctx.Done():
+			}
+			if job.stop(errJobInterrupted) {
+				s.logger.Info(ctx, "Interrupting ingestion", map[string]any{"job_id": job.snapshot().ID})
+			}
+			<-job.done
+		}()
+	}
+	wg.Wait()
+
+	s.logger.Info(ctx, "Server stopped", nil)
+	return shutdownErr
+}
+
+// resumeJobs runs again the ingestion jobs recorded by a previous run that
+// did not finish. Jobs that are no longer valid, for example because their
+// collection was deleted, are dropped.
+func (s *Server) resumeJobs(ctx context.Context) {
+	records, err := s.jobs.unfinished()
+	if err != nil {
+		s.logger.Error(ctx, "Failed to read unfinished ingestion jobs", map[string]any{"error": err.Error()})
+		return
+	}
+
+	for _, record := range records {
+		s.logger.Info(ctx, "Resuming ingestion", map[string]any{"job_id": record.ID})
+		if _, err := s.startIngestJob(ctx, record.Request, &record); err != nil {
+			s.logger.Error(ctx, "Failed to resume ingestion", map[string]any{"error": err.Error(), "job_id": record.ID})
+			if err := s.jobs.forget(record.ID); err != nil {
+				s.logger.Error(ctx, "Failed to remove ingestion job record", map[string]any{"error": err.Error(), "job_id": record.ID})
+			}
+		}
 	}
-	return nil
 }
 
 // registerHandlers sets up all HTTP endpoints
-func (s *Server) registerHandlers() {
-	http.HandleFunc("/run", s.handleQuery)
-	http.HandleFunc("/ingest", s.handleIngest)
-	http.HandleFunc("/health", s.handleHealth)
+func (s *Server) registerHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/run", s.handleQuery)
+	mux.HandleFunc("/run/stream", s.handleQueryStream)
+	mux.HandleFunc("/ingest", s.handleIngest)
+	mux.HandleFunc("GET /ingest/{id}", s.handleIngestStatus)
+	mux.HandleFunc("DELETE /ingest/{id}", s.handleCancelIngest)
+	mux.HandleFunc("POST /collections", s.handleCreateCollection)
+	mux.HandleFunc("GET /collections", s.handleListCollections)
+	mux.HandleFunc("DELETE /collections/{name}", s.handleDeleteCollection)
+	mux.HandleFunc("POST /sessions", s.handleCreateSession)
+	mux.HandleFunc("GET /sessions/{id}", s.handleGetSession)
+	mux.HandleFunc("DELETE /sessions/{id}", s.handleDeleteSession)
+	mux.HandleFunc("/reset", s.handleReset)
+	mux.HandleFunc("/health", s.handleHealth)
 }
 
 // logServerInfo prints server startup information
@@ -100,7 +364,17 @@ func (s *Server) logServerInfo(ctx context.Context) {
 	fmt.Printf("Server running on http://localhost:%s\n", s.port)
 	fmt.Printf("Endpoints available:\n")
 	fmt.Printf("  POST /run     - Query the documentation\n")
+	fmt.Printf("  POST /run/stream - Query the documentation, streamed as SSE\n")
 	fmt.Printf("  POST /ingest  - Ingest new documentation\n")
+	fmt.Printf("  GET  /ingest/{id} - Ingestion job status\n")
+	fmt.Printf("  DELETE /ingest/{id} - Cancel an ingestion job\n")
+	fmt.Printf("  POST /collections - Create a collection\n")
+	fmt.Printf("  GET  /collections - List collections\n")
+	fmt.Printf("  DELETE /collections/{name} - Delete a collection and its chunks\n")
+	fmt.Printf("  POST /sessions - Start a conversation\n")
+	fmt.Printf("  GET  /sessions/{id} - Conversation transcript\n")
+	fmt.Printf("  DELETE /sessions/{id} - Drop a conversation\n")
+	fmt.Printf("  POST /reset   - Clear a collection's vector namespace\n")
 	fmt.Printf("  GET  /health  - Health check\n")
 }
 
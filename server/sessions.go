@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/avivnoah/documentation-assistant/pkg/session"
+)
+
+// Session stores accepted in Config.SessionStore
+const (
+	SessionStoreMemory = "memory"
+	SessionStoreFile   = "file"
+)
+
+// errSessionWithHistory rejects queries that name a session and also send a history
+var errSessionWithHistory = errors.New("session_id and chat_history cannot be used together")
+
+// CreateSessionResponse is returned by POST /sessions
+type CreateSessionResponse struct {
+	SessionID string    `json:"session_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// newSessionStore creates the session store selected by config.SessionStore
+func newSessionStore(config Config) (session.Store, error) {
+	switch config.SessionStore {
+	case SessionStoreMemory:
+		return session.NewMemory(), nil
+	case SessionStoreFile:
+		return session.NewFile(config.SessionDir)
+	default:
+		return nil, fmt.Errorf("unknown session store %q", config.SessionStore)
+	}
+}
+
+// handleCreateSession starts an empty conversation
+func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	sess, err := s.sessions.Create(r.Context())
+	if err != nil {
+		s.logger.Error(r.Context(), "Failed to create session", map[string]any{"error": err.Error()})
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/sessions/"+sess.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateSessionResponse{SessionID: sess.ID, CreatedAt: sess.CreatedAt})
+}
+
+// handleGetSession returns the transcript of a conversation
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	sess, err := s.sessions.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+
+	respondWithJSON(w, sess)
+}
+
+// handleDeleteSession drops a conversation
+func (s *Server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.sessions.Delete(r.Context(), id); err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+
+	respondWithJSON(w, map[string]string{"status": "deleted", "session_id": id})
+}
+
+// chatHistory returns the conversation preceding req: the session named by
+// req, or a transient session holding the client's chat_history
+func (s *Server) chatHistory(ctx context.Context, req QueryRequest) (session.Session, error) {
+	if req.SessionID == "" {
+		turns := make([]session.Turn, 0, len(req.ChatHistory))
+		for _, msg := range req.ChatHistory {
+			if len(msg) != 2 {
+				continue // Skip malformed entries
+			}
+			turns = append(turns, session.Turn{Role: msg[0], Content: msg[1]})
+		}
+		return session.Session{Turns: turns}, nil
+	}
+	if len(req.ChatHistory) > 0 {
+		return session.Session{}, errSessionWithHistory
+	}
+
+	return s.sessions.Get(ctx, req.SessionID)
+}
+
+// recordTurn appends a question and its answer to the request's session.
+// Failures are logged rather than returned, since the answer is already complete.
+func (s *Server) recordTurn(ctx context.Context, req QueryRequest, answer string) {
+	if req.SessionID == "" {
+		return
+	}
+
+	_, err := s.sessions.Append(ctx, req.SessionID,
+		session.Turn{Role: session.RoleHuman, Content: req.Query},
+		session.Turn{Role: session.RoleAI, Content: answer},
+	)
+	if err != nil {
+		s.logger.Error(ctx, "Failed to record session turn", map[string]any{"error": err.Error(), "session_id": req.SessionID})
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// SSE event names emitted by the streaming query endpoint
+const (
+	eventQuestion = "question"
+	eventSources  = "sources"
+	eventToken    = "token"
+	eventDone     = "done"
+	eventError    = "error"
+)
+
+type streamQuestionEvent struct {
+	Question string `json:"question"`
+}
+
+type streamSourcesEvent struct {
+	Sources []QuerySource `json:"sources"`
+}
+
+type streamTokenEvent struct {
+	Text string `json:"text"`
+}
+
+// streamDoneEvent ends a successful stream. Answer is the answer with invalid
+// citations removed, so it replaces the text of the token events.
+type streamDoneEvent struct {
+	Version          int          `json:"version"`
+	Answer           string       `json:"answer"`
+	Query            string       `json:"query"`
+	Citations        []Citation   `json:"citations"`
+	InvalidCitations []int        `json:"invalid_citations,omitempty"`
+	SessionID        string       `json:"session_id,omitempty"`
+	Memory           MemoryReport `json:"memory"`
+	RetrievalMode    string       `json:"retrieval_mode"`
+	Rerank           string       `json:"rerank"`
+	Collection       string       `json:"collection"`
+	Tokens           int          `json:"tokens"`
+	Sources          int          `json:"sources"`
+	DurationMs       int64        `json:"duration_ms"`
+}
+
+// sseWriter writes Server-Sent Events to a response and flushes after each one
+type sseWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming is not supported by this connection")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &sseWriter{w: w, flusher: flusher}, nil
+}
+
+// send writes one event with a JSON encoded data payload
+func (s *sseWriter) send(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// handleQueryStream answers a query and streams the intermediate steps and answer tokens as SSE
+func (s *Server) handleQueryStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := decodeQueryRequest(r)
+	if err != nil {
+		respondWithError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := s.queryContext(r, req)
+	if err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+	defer cancel()
+	if err := s.validateModel(req.Model); err != nil {
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+		return
+	}
+
+	retrieval, err := s.retrievalOptions(ctx, req)
+	if err != nil {
+		s.respondWithQueryError(ctx, w, err)
+		return
+	}
+	conversationMemory, memoryReport, err := s.conversationMemory(ctx, req)
+	if err != nil {
+		s.respondWithQueryError(ctx, w, err)
+		return
+	}
+
+	events, err := newSSEWriter(w)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	start := time.Now()
+	var answer strings.Builder
+	tokens := 0
+	var retrieved []schema.Document
+
+	hooks := &llmHooks{
+		onRetrieve: func(question string, docs []schema.Document) {
+			retrieved = docs
+			events.send(eventQuestion, streamQuestionEvent{Question: question})
+			events.send(eventSources, streamSourcesEvent{Sources: newQuerySources(docs)})
+		},
+		onToken: func(ctx context.Context, chunk []byte) error {
+			tokens++
+			answer.Write(chunk)
+			return events.send(eventToken, streamTokenEvent{Text: string(chunk)})
+		},
+	}
+
+	result, err := s.runLLM(ctx, retrieval, req.Query, req.Model, conversationMemory, hooks)
+	if err != nil {
+		if queryTimedOut(ctx) {
+			events.send(eventError, map[string]string{"error": errQueryTimeout.Error(), "code": ErrorCodeTimeout})
+		} else if ctx.Err() == nil {
+			events.send(eventError, map[string]string{"error": err.Error()})
+		}
+		return
+	}
+
+	// Some providers ignore the streaming function, so fall back to the full result
+	text, _ := result["result"].(string)
+	if answer.Len() == 0 && text != "" {
+		tokens++
+		events.send(eventToken, streamTokenEvent{Text: text})
+	}
+
+	response := newQueryResponse(req.Query, text, retrieved)
+	s.recordTurn(r.Context(), req, response.Answer)
+	events.send(eventDone, streamDoneEvent{
+		Version:          response.Version,
+		Answer:           response.Answer,
+		Query:            response.Query,
+		Citations:        response.Citations,
+		InvalidCitations: response.InvalidCitations,
+		SessionID:        req.SessionID,
+		Memory:           memoryReport,
+		RetrievalMode:    retrieval.Mode,
+		Rerank:           retrieval.Rerank,
+		Collection:       retrieval.base.collection.Name,
+		Tokens:           tokens,
+		Sources:          len(retrieved),
+		DurationMs:       time.Since(start).Milliseconds(),
+	})
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Query deadlines. The default stays below the 60 s timeout of the Streamlit
+// client, so it gets the timeout error rather than a dropped connection.
+const (
+	defaultQueryTimeout = 50 * time.Second
+	maxQueryTimeout     = 10 * time.Minute // Longest timeout_ms accepted
+)
+
+// ErrorCodeTimeout is the code of the error returned when a query runs past
+// its deadline, with status 504 or as the code of the streaming error event
+const ErrorCodeTimeout = "timeout"
+
+var (
+	errQueryTimeout   = errors.New("query deadline exceeded")
+	errInvalidTimeout = errors.New("timeout_ms must not be negative")
+)
+
+// queryTimeout returns the deadline of req: its timeout_ms, at most
+// maxQueryTimeout, or the configured default
+func (s *Server) queryTimeout(req QueryRequest) (time.Duration, error) {
+	if req.TimeoutMs < 0 {
+		return 0, errInvalidTimeout
+	}
+	if req.TimeoutMs == 0 {
+		return s.config.QueryTimeout, nil
+	}
+	return min(time.Duration(req.TimeoutMs)*time.Millisecond, maxQueryTimeout), nil
+}
+
+// queryContext derives the context a query runs with from the request's. It
+// is cancelled when the client disconnects or when the query's deadline
+// passes, in which case its cause is errQueryTimeout.
+func (s *Server) queryContext(r *http.Request, req QueryRequest) (context.Context, context.CancelFunc, error) {
+	timeout, err := s.queryTimeout(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeoutCause(r.Context(), timeout, errQueryTimeout)
+	return ctx, cancel, nil
+}
+
+// queryTimedOut reports whether the query running with ctx failed because its
+// deadline passed. Providers do not all wrap context errors, so the context
+// is checked rather than the returned error.
+func queryTimedOut(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errQueryTimeout)
+}
+
+// respondWithQueryError reports an error from answering a query. Nothing is
+// written when the client has gone away.
+func (s *Server) respondWithQueryError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case queryTimedOut(ctx):
+		s.logger.Error(ctx, "Query timed out", map[string]any{"error": err.Error()})
+		respondWithErrorCode(w, errQueryTimeout.Error(), ErrorCodeTimeout, http.StatusGatewayTimeout)
+	case errors.Is(context.Cause(ctx), context.Canceled):
+		s.logger.Info(ctx, "Query cancelled by the client", map[string]any{"error": err.Error()})
+	default:
+		respondWithError(w, err.Error(), requestErrorStatus(err))
+	}
+}